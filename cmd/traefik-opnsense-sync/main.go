@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
+	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/0x464e/traefik-opnsense-sync/internal/app"
@@ -21,7 +24,33 @@ func main() {
 
 	tosApp := app.NewApp(&cfg)
 
+	if len(os.Args) > 1 && os.Args[1] == "explain" {
+		explain(ctx, tosApp, os.Args[2:])
+		return
+	}
+
 	if err := tosApp.Run(ctx); err != nil {
 		log.Printf("app exited: %v", err)
 	}
 }
+
+// explain [-router name@provider] [rule]
+func explain(ctx context.Context, tosApp *app.App, args []string) {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	router := fs.String("router", "", "explain a router from the live Traefik API, e.g. myapp@docker")
+	fs.Usage = func() {
+		_, _ = fs.Output().Write([]byte("usage: traefik-opnsense-sync explain [-router name@provider] [rule]\n"))
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	rule := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if (*router == "") == (rule == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := tosApp.Explain(ctx, *router, rule, os.Stdout); err != nil {
+		log.Fatalf("explain: %v", err)
+	}
+}
@@ -60,5 +60,6 @@ func (a *App) Run(ctx context.Context) error {
 }
 
 func (a *App) syncOnce(ctx context.Context) error {
-	return a.runner.Sync(ctx)
+	_, err := a.runner.Sync(ctx)
+	return err
 }
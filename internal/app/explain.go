@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/syncer"
+	"github.com/0x464e/traefik-opnsense-sync/internal/traefik"
+)
+
+// Explain prints what a router from the live Traefik API, or a raw rule if routerName is empty,
+// would produce: the parsed rule, its host matchers, regex expansions, filters and final aliases
+func (a *App) Explain(ctx context.Context, routerName, rule string, w io.Writer) error {
+	var explanation *syncer.Explanation
+	var err error
+	if routerName != "" {
+		explanation, err = a.runner.ExplainRouter(ctx, routerName)
+	} else {
+		explanation, err = a.runner.ExplainRule(rule)
+	}
+	if err != nil {
+		return err
+	}
+
+	if router := explanation.Router; router != nil {
+		_, _ = fmt.Fprintf(w, "Router: %s (provider: %s, entrypoints: %s)\n", router.Name, router.Provider, strings.Join(router.EntryPoints, ", "))
+		rule = router.Rule
+	}
+	_, _ = fmt.Fprintf(w, "Rule: %s\n\n", rule)
+
+	_, _ = fmt.Fprintf(w, "Parsed tree:\n%s\n\n", indent(explanation.Rule.Tree))
+
+	_, _ = fmt.Fprintln(w, "Host matchers:")
+	if len(explanation.Rule.Domains) == 0 && len(explanation.Rule.Negated) == 0 {
+		_, _ = fmt.Fprintln(w, "  (none)")
+	}
+	for _, domain := range explanation.Rule.Domains {
+		switch domain.Kind {
+		case traefik.DomainWildcard:
+			_, _ = fmt.Fprintf(w, "  + %s (wildcard %s)\n", domain.Fragment, domain.Value)
+		default:
+			_, _ = fmt.Fprintf(w, "  + %s\n", domain.Fragment)
+		}
+	}
+	for _, negated := range explanation.Rule.Negated {
+		_, _ = fmt.Fprintf(w, "  - %s (negated)\n", negated)
+	}
+	_, _ = fmt.Fprintln(w)
+
+	if len(explanation.Expansions) > 0 {
+		_, _ = fmt.Fprintln(w, "Regex expansions:")
+		for _, expansion := range explanation.Expansions {
+			if expansion.Err != nil {
+				_, _ = fmt.Fprintf(w, "  %s → error: %v\n", expansion.Regex, expansion.Err)
+				continue
+			}
+			_, _ = fmt.Fprintf(w, "  %s → %s\n", expansion.Regex, strings.Join(expansion.Hosts, ", "))
+		}
+		_, _ = fmt.Fprintln(w)
+	}
+
+	if explanation.Router != nil {
+		verdict := "accepted"
+		if !explanation.Accepted {
+			verdict = "rejected"
+		}
+		_, _ = fmt.Fprintf(w, "Filters: %s (%s)\n\n", verdict, explanation.FilterReason)
+	}
+
+	_, _ = fmt.Fprintln(w, "Aliases:")
+	if len(explanation.Aliases) == 0 {
+		_, _ = fmt.Fprintln(w, "  (none)")
+	}
+	for _, alias := range explanation.Aliases {
+		_, _ = fmt.Fprintf(w, "  %s → %s (hostname %q, domain %q)\n", alias.Key(), alias.Target, alias.Hostname, alias.Domain)
+	}
+	for _, invalid := range explanation.Result.InvalidNames {
+		_, _ = fmt.Fprintf(w, "  skipped %s: %v\n", invalid.Name, invalid.Err)
+	}
+	for _, outside := range explanation.Result.OutsideZones {
+		_, _ = fmt.Fprintf(w, "  outside configured zones: %s\n", outside)
+	}
+
+	return nil
+}
+
+func indent(s string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = "  " + line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -3,15 +3,24 @@ package config
 import (
 	"fmt"
 	"log"
+	"net/netip"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/go-viper/mapstructure/v2"
 	"github.com/spf13/viper"
 )
 
+type entryPointDomainCfg struct {
+	EntryPoint string `mapstructure:"entrypoint"`
+	Domain     string `mapstructure:"domain"`
+}
+
 type traefikCfg struct {
 	BaseURL            string   `mapstructure:"base_url"`
 	IncludeEntryPoints []string `mapstructure:"include_entrypoints"`
@@ -21,24 +30,85 @@ type traefikCfg struct {
 	Username           string   `mapstructure:"username"`
 	Password           string   `mapstructure:"password"`
 	VerifyTLS          bool     `mapstructure:"verify_tls"`
+	ParseErrorPolicy   string   `mapstructure:"parse_error_policy"`
+	DefaultDomain      string   `mapstructure:"default_domain"`
+
+	EntryPointDomains []entryPointDomainCfg `mapstructure:"entrypoint_domains"`
 }
 
-type opnSenseCfg struct {
-	BaseURL      string `mapstructure:"base_url"`
-	APIKey       string `mapstructure:"api_key"`
-	APISecret    string `mapstructure:"api_secret"`
+type mappingCfg struct {
+	HostOverride   []string `mapstructure:"host_override"`
+	EntryPoints    []string `mapstructure:"entrypoints"`
+	Providers      []string `mapstructure:"providers"`
+	Routers        []string `mapstructure:"routers"`
+	DomainSuffixes []string `mapstructure:"domain_suffixes"`
+}
+
+type addressCfg struct {
 	HostOverride string `mapstructure:"host_override"`
-	VerifyTLS    bool   `mapstructure:"verify_tls"`
+	IP           string `mapstructure:"ip"`
+}
+
+type opnSenseCfg struct {
+	BaseURL      string       `mapstructure:"base_url"`
+	Backend      string       `mapstructure:"backend"`
+	Mode         string       `mapstructure:"mode"`
+	Addresses    []addressCfg `mapstructure:"addresses"`
+	APIKey       string       `mapstructure:"api_key"`
+	APISecret    string       `mapstructure:"api_secret"`
+	HostOverride []string     `mapstructure:"host_override"`
+	Mappings     []mappingCfg `mapstructure:"mappings"`
+	VerifyTLS    bool         `mapstructure:"verify_tls"`
+}
+
+type regexExpansionCfg struct {
+	Pattern string   `mapstructure:"pattern"`
+	Router  string   `mapstructure:"router"`
+	Hosts   []string `mapstructure:"hosts"`
 }
 
 type regexCfg struct {
-	MaxGenerated int    `mapstructure:"max_generated"`
-	ExrexPath    string `mapstructure:"exrex_path"`
+	MaxGenerated int                 `mapstructure:"max_generated"`
+	Expansions   []regexExpansionCfg `mapstructure:"expansions"`
+	Wildcards    bool                `mapstructure:"wildcards"`
+}
+
+type rewriteCfg struct {
+	Regex        string `mapstructure:"regex"`
+	Suffix       string `mapstructure:"suffix"`
+	Replacement  string `mapstructure:"replacement"`
+	KeepOriginal bool   `mapstructure:"keep_original"`
+}
+
+type compactionCfg struct {
+	Enabled   bool `mapstructure:"enabled"`
+	Threshold int  `mapstructure:"threshold"`
+}
+
+type descriptionCfg struct {
+	Template string `mapstructure:"template"`
+	Marker   string `mapstructure:"marker"`
+}
+
+// ParseTemplate parses the description template, with a join function for the list fields
+func (d descriptionCfg) ParseTemplate() (*template.Template, error) {
+	return template.New("description").Funcs(template.FuncMap{"join": strings.Join}).Parse(d.Template)
 }
 
 type reconcileCfg struct {
-	Interval       time.Duration `mapstructure:"interval"`
-	DescriptionTag string        `mapstructure:"description_tag"`
+	Interval               time.Duration  `mapstructure:"interval"`
+	DescriptionTag         string         `mapstructure:"description_tag"`
+	LegacyDescriptionTags  []string       `mapstructure:"legacy_description_tags"`
+	Description            descriptionCfg `mapstructure:"description"`
+	Zones                  []string       `mapstructure:"zones"`
+	OutsideZonePolicy      string         `mapstructure:"outside_zone_policy"`
+	Rewrites               []rewriteCfg   `mapstructure:"rewrites"`
+	Compaction             compactionCfg  `mapstructure:"compaction"`
+	ProtectedDomains       []string       `mapstructure:"protected_domains"`
+	CreateProtectedDomains bool           `mapstructure:"create_protected_domains"`
+	Adoption               string         `mapstructure:"adoption"`
+	DisabledPolicy         string         `mapstructure:"disabled_policy"`
+	ConflictPolicy         string         `mapstructure:"conflict_policy"`
 }
 
 type Config struct {
@@ -103,17 +173,27 @@ func setDefaults(v *viper.Viper) {
 
 	// Traefik
 	v.SetDefault("traefik.verify_tls", true)
+	v.SetDefault("traefik.parse_error_policy", "skip")
 
 	// OPNsense
 	v.SetDefault("opnsense.verify_tls", true)
+	v.SetDefault("opnsense.backend", "unbound")
+	v.SetDefault("opnsense.mode", "alias")
 
 	// regex
 	v.SetDefault("regex.max_generated", 5)
-	v.SetDefault("regex.exrex_path", "exrex")
+	v.SetDefault("regex.wildcards", false)
 
 	// reconcile
 	v.SetDefault("reconcile.interval", "30s")
 	v.SetDefault("reconcile.description_tag", "Managed by traefik-opnsense-sync")
+	v.SetDefault("reconcile.outside_zone_policy", "default")
+	v.SetDefault("reconcile.description.marker", "prefix")
+	v.SetDefault("reconcile.adoption", "off")
+	v.SetDefault("reconcile.disabled_policy", "respect")
+	v.SetDefault("reconcile.conflict_policy", "create")
+	v.SetDefault("reconcile.compaction.enabled", false)
+	v.SetDefault("reconcile.compaction.threshold", 10)
 }
 
 // read TOS_*_FILE envs and set the corresponding TOS_* env with the file contents
@@ -176,12 +256,17 @@ func validate(config *Config) error {
 	if strings.TrimSpace(config.OPNsense.APISecret) == "" {
 		errs = append(errs, "opnsense.api_secret is required")
 	}
-	if strings.TrimSpace(config.OPNsense.HostOverride) == "" {
+	if len(config.OPNsense.HostOverride) == 0 {
 		errs = append(errs, "opnsense.host_override is required")
 	}
 	if strings.TrimSpace(config.Reconcile.DescriptionTag) == "" {
 		errs = append(errs, "reconcile.description_tag is required")
 	}
+	for i, tag := range config.Reconcile.LegacyDescriptionTags {
+		if strings.TrimSpace(tag) == "" || tag == config.Reconcile.DescriptionTag {
+			errs = append(errs, fmt.Sprintf("reconcile.legacy_description_tags[%d] must be non-empty and differ from reconcile.description_tag", i))
+		}
+	}
 
 	// guardrails
 	if config.Regex.MaxGenerated <= 0 {
@@ -190,9 +275,79 @@ func validate(config *Config) error {
 	if config.Reconcile.Interval <= 0 {
 		errs = append(errs, "reconcile.interval must be > 0")
 	}
+	if config.Reconcile.Compaction.Enabled && config.Reconcile.Compaction.Threshold < 2 {
+		errs = append(errs, "reconcile.compaction.threshold must be >= 2")
+	}
 	if err := validateIgnoreRouters(config.Traefik.IgnoreRouters); err != nil {
 		errs = append(errs, err.Error())
 	}
+	errs = append(errs, validateMappings(config.OPNsense.Mappings)...)
+	switch config.OPNsense.Backend {
+	case "unbound":
+	case "dnsmasq":
+		// dnsmasq hosts have no wildcard names, and its domain overrides forward queries instead of answering them
+		if config.Regex.Wildcards {
+			errs = append(errs, "regex.wildcards is not supported with opnsense.backend dnsmasq")
+		}
+		if config.Reconcile.Compaction.Enabled {
+			errs = append(errs, "reconcile.compaction is not supported with opnsense.backend dnsmasq")
+		}
+	default:
+		errs = append(errs, "opnsense.backend must be one of: unbound, dnsmasq")
+	}
+	switch config.OPNsense.Mode {
+	case "alias":
+	case "override":
+		if config.OPNsense.Backend != "unbound" {
+			errs = append(errs, "opnsense.mode override is only supported with opnsense.backend unbound")
+		}
+		errs = append(errs, validateAddresses(config.OPNsense)...)
+	default:
+		errs = append(errs, "opnsense.mode must be one of: alias, override")
+	}
+	if config.Traefik.ParseErrorPolicy != "skip" && config.Traefik.ParseErrorPolicy != "abort" {
+		errs = append(errs, "traefik.parse_error_policy must be one of: skip, abort")
+	}
+	for i, epDomain := range config.Traefik.EntryPointDomains {
+		if strings.TrimSpace(epDomain.EntryPoint) == "" || strings.TrimSpace(epDomain.Domain) == "" {
+			errs = append(errs, fmt.Sprintf("traefik.entrypoint_domains[%d] must set both entrypoint and domain", i))
+		}
+	}
+	errs = append(errs, validateExpansions(config.Regex.Expansions)...)
+	errs = append(errs, validateRewrites(config.Reconcile.Rewrites)...)
+	for i, pattern := range config.Reconcile.ProtectedDomains {
+		if strings.TrimSpace(pattern) == "" {
+			errs = append(errs, fmt.Sprintf("reconcile.protected_domains[%d] must not be empty", i))
+		} else if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("reconcile.protected_domains[%d] %q is not a valid glob: %v", i, pattern, err))
+		}
+	}
+	if config.Reconcile.Description.Template != "" {
+		if _, err := config.Reconcile.Description.ParseTemplate(); err != nil {
+			errs = append(errs, fmt.Sprintf("reconcile.description.template is invalid: %v", err))
+		}
+	}
+	if config.Reconcile.Description.Marker != "prefix" && config.Reconcile.Description.Marker != "suffix" {
+		errs = append(errs, "reconcile.description.marker must be one of: prefix, suffix")
+	}
+	switch config.Reconcile.Adoption {
+	case "off", "report", "on":
+	default:
+		errs = append(errs, "reconcile.adoption must be one of: off, report, on")
+	}
+	if config.Reconcile.DisabledPolicy != "respect" && config.Reconcile.DisabledPolicy != "repair" {
+		errs = append(errs, "reconcile.disabled_policy must be one of: respect, repair")
+	}
+	switch config.Reconcile.ConflictPolicy {
+	case "skip", "create", "fail":
+	default:
+		errs = append(errs, "reconcile.conflict_policy must be one of: skip, create, fail")
+	}
+	switch config.Reconcile.OutsideZonePolicy {
+	case "default", "warn", "skip":
+	default:
+		errs = append(errs, "reconcile.outside_zone_policy must be one of: default, warn, skip")
+	}
 	if len(config.Traefik.IgnoreProviders) > 0 && len(config.Traefik.IncludeProviders) > 0 {
 		errs = append(errs, "traefik.ignore_providers and traefik.include_providers are mutually exclusive")
 	}
@@ -218,6 +373,110 @@ func validateIgnoreRouters(routers []string) error {
 	return nil
 }
 
+func validateMappings(mappings []mappingCfg) []string {
+	var errs []string
+	for i, mapping := range mappings {
+		if len(mapping.HostOverride) == 0 {
+			errs = append(errs, fmt.Sprintf("opnsense.mappings[%d] host_override is required", i))
+		}
+		if len(mapping.EntryPoints) == 0 && len(mapping.Providers) == 0 && len(mapping.Routers) == 0 && len(mapping.DomainSuffixes) == 0 {
+			errs = append(errs, fmt.Sprintf("opnsense.mappings[%d] must match on at least one of entrypoints, providers, routers or domain_suffixes", i))
+		}
+		for _, router := range mapping.Routers {
+			if !strings.Contains(router, "@") {
+				errs = append(errs, fmt.Sprintf("opnsense.mappings[%d] router %q must include provider suffix, e.g. 'router@docker'", i, router))
+			}
+		}
+	}
+	return errs
+}
+
+// in override mode every target needs exactly one address, and no two targets may share one
+func validateAddresses(opnsense opnSenseCfg) []string {
+	var errs []string
+	addresses := make(map[string]string)
+	targets := make(map[string]string)
+	for i, address := range opnsense.Addresses {
+		target := strings.ToLower(strings.TrimSpace(address.HostOverride))
+		ip, err := netip.ParseAddr(strings.TrimSpace(address.IP))
+		if target == "" || err != nil {
+			errs = append(errs, fmt.Sprintf("opnsense.addresses[%d] must set host_override and a valid ip", i))
+			continue
+		}
+		if _, ok := addresses[target]; ok {
+			errs = append(errs, fmt.Sprintf("opnsense.addresses[%d] %s has more than one address, use a separate host_override per address", i, target))
+		}
+		if other, ok := targets[ip.String()]; ok {
+			errs = append(errs, fmt.Sprintf("opnsense.addresses[%d] %s shares its ip with %s", i, target, other))
+		}
+		addresses[target] = ip.String()
+		targets[ip.String()] = target
+	}
+
+	required := append([]string{}, opnsense.HostOverride...)
+	for _, mapping := range opnsense.Mappings {
+		required = append(required, mapping.HostOverride...)
+	}
+	for _, target := range required {
+		target = strings.ToLower(strings.TrimSpace(target))
+		if _, ok := addresses[target]; target != "" && !ok {
+			errs = append(errs, fmt.Sprintf("opnsense.addresses is missing an ip for %s, required with opnsense.mode override", target))
+			// report each target once
+			addresses[target] = ""
+		}
+	}
+	return errs
+}
+
+func validateRewrites(rewrites []rewriteCfg) []string {
+	var errs []string
+	for i, rewrite := range rewrites {
+		if (rewrite.Regex == "") == (rewrite.Suffix == "") {
+			errs = append(errs, fmt.Sprintf("reconcile.rewrites[%d] must set exactly one of regex or suffix", i))
+			continue
+		}
+		if rewrite.Regex != "" {
+			if _, err := regexp.Compile(rewrite.Regex); err != nil {
+				errs = append(errs, fmt.Sprintf("reconcile.rewrites[%d] regex %q is invalid: %v", i, rewrite.Regex, err))
+			}
+		}
+	}
+	return errs
+}
+
+func validateExpansions(expansions []regexExpansionCfg) []string {
+	var errs []string
+	for i, expansion := range expansions {
+		if (expansion.Pattern == "") == (expansion.Router == "") {
+			errs = append(errs, fmt.Sprintf("regex.expansions[%d] must set exactly one of pattern or router", i))
+			continue
+		}
+		if len(expansion.Hosts) == 0 {
+			errs = append(errs, fmt.Sprintf("regex.expansions[%d] must list at least one host", i))
+		}
+		if expansion.Router != "" {
+			if !strings.Contains(expansion.Router, "@") {
+				errs = append(errs, fmt.Sprintf("regex.expansions[%d] router %q must include provider suffix, e.g. 'router@docker'", i, expansion.Router))
+			}
+			// hosts of router expansions are checked against the router's regexes during sync
+			continue
+		}
+
+		// HostRegexp matching is case-insensitive in Traefik
+		re, err := regexp.Compile("(?i)" + expansion.Pattern)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("regex.expansions[%d] pattern %q is invalid: %v", i, expansion.Pattern, err))
+			continue
+		}
+		for _, host := range expansion.Hosts {
+			if !re.MatchString(host) {
+				errs = append(errs, fmt.Sprintf("regex.expansions[%d] host %q does not match pattern %q", i, host, expansion.Pattern))
+			}
+		}
+	}
+	return errs
+}
+
 func absoluteIfRelative(path string) (string, error) {
 	if filepath.IsAbs(path) {
 		return path, nil
@@ -0,0 +1,96 @@
+package dnsname
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	maxNameLength  = 253
+	maxLabelLength = 63
+)
+
+var idnaProfile = idna.New(idna.MapForLookup(), idna.Transitional(false))
+
+// Normalize lower-cases name, strips a trailing dot and port, converts Unicode labels to
+// punycode and validates the result as an RFC 1035/1123 hostname. A leading "*" label is allowed.
+func Normalize(name string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	normalized = stripPort(normalized)
+	normalized = strings.TrimSuffix(normalized, ".")
+	if normalized == "" {
+		return "", errors.New("empty name")
+	}
+
+	wildcard := false
+	if rest, found := strings.CutPrefix(normalized, "*."); found {
+		wildcard = true
+		normalized = rest
+	}
+
+	ascii, err := idnaProfile.ToASCII(normalized)
+	if err != nil {
+		return "", fmt.Errorf("invalid name %q: %w", name, err)
+	}
+	if err := validate(ascii); err != nil {
+		return "", fmt.Errorf("invalid name %q: %w", name, err)
+	}
+
+	if wildcard {
+		ascii = "*." + ascii
+	}
+	return ascii, nil
+}
+
+// NormalizeLabels is Normalize for a hostname part, which may be empty or contain several labels
+func NormalizeLabels(hostname string) (string, error) {
+	if hostname == "" || hostname == "*" {
+		return hostname, nil
+	}
+	return Normalize(hostname)
+}
+
+func stripPort(name string) string {
+	host, port, found := strings.Cut(name, ":")
+	if !found {
+		return name
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return name
+	}
+	return host
+}
+
+func validate(name string) error {
+	if len(name) > maxNameLength {
+		return fmt.Errorf("longer than %d characters", maxNameLength)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if err := validateLabel(label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateLabel(label string) error {
+	if label == "" {
+		return errors.New("empty label")
+	}
+	if len(label) > maxLabelLength {
+		return fmt.Errorf("label %q longer than %d characters", label, maxLabelLength)
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return fmt.Errorf("label %q starts or ends with a hyphen", label)
+	}
+	for _, c := range label {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return fmt.Errorf("label %q contains invalid character %q", label, c)
+		}
+	}
+	return nil
+}
@@ -1,108 +1,228 @@
 package exrex
 
+// Native replacement for the exrex Python tool: enumerates the finite language of a regex
+// by walking its regexp/syntax tree. Patterns are interpreted in host context, meaning
+// that '.' is treated as a literal dot instead of "any character".
+
 import (
-	"context"
 	"errors"
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
-	"strconv"
+	"regexp/syntax"
 	"strings"
 	"sync"
-	"time"
+	"unicode"
 
 	"github.com/0x464e/traefik-opnsense-sync/internal/config"
+	"github.com/0x464e/traefik-opnsense-sync/internal/slicesx"
+)
+
+// hardLimit caps the amount of strings held at any point of the enumeration,
+// so pathological patterns such as [a-z]{10} fail fast instead of eating all memory
+const hardLimit = 10000
+
+var (
+	ErrInfinite = errors.New("pattern matches an infinite number of hosts")
+	ErrTooLarge = fmt.Errorf("pattern matches more than %d hosts", hardLimit)
 )
 
 type Exrex struct {
-	ExrexPath    string
 	MaxGenerated int
-	Cache        map[string][]string
 
-	once              sync.Once
-	resolvedExrexPath string
-	resolveErr        error
+	mu    sync.Mutex
+	cache map[string]*cacheEntry
 }
 
-func NewExrexRunner(cfg *config.Config) *Exrex {
+type cacheEntry struct {
+	generated []string
+	err       error
+	used      bool
+}
+
+func NewExrex(cfg *config.Config) *Exrex {
 	return &Exrex{
-		ExrexPath:    cfg.Regex.ExrexPath,
 		MaxGenerated: cfg.Regex.MaxGenerated,
-		Cache:        make(map[string][]string),
+		cache:        make(map[string]*cacheEntry),
 	}
 }
 
+// Generate returns up to MaxGenerated strings matched by pattern, in enumeration order.
+// Patterns matching an infinite language return ErrInfinite.
+// Results, including errors, are cached until evicted by Sweep.
 func (e *Exrex) Generate(pattern string) ([]string, error) {
-	if v, ok := e.Cache[pattern]; ok {
-		return v, nil
+	e.mu.Lock()
+	entry, ok := e.cache[pattern]
+	if ok {
+		entry.used = true
 	}
-	if strings.TrimSpace(pattern) == "" {
-		return nil, errors.New("empty regex pattern")
+	e.mu.Unlock()
+	if ok {
+		return entry.generated, entry.err
 	}
 
-	// resolve exrex path once, on demand.
-	e.once.Do(func() {
-		e.resolvedExrexPath, e.resolveErr = resolveExecutable(e.ExrexPath)
-		if e.resolveErr != nil {
-			e.resolveErr = fmt.Errorf("%w: %v", errors.New("exrex not available"), e.resolveErr)
+	generated, err := e.generate(pattern)
+
+	e.mu.Lock()
+	e.cache[pattern] = &cacheEntry{generated: generated, err: err, used: true}
+	e.mu.Unlock()
+	return generated, err
+}
+
+// Sweep evicts patterns not used since the previous sweep and returns how many were evicted
+func (e *Exrex) Sweep() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	evicted := 0
+	for pattern, entry := range e.cache {
+		if !entry.used {
+			delete(e.cache, pattern)
+			evicted++
+			continue
 		}
-	})
-	if e.resolveErr != nil {
-		return nil, e.resolveErr
+		entry.used = false
 	}
+	return evicted
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func (e *Exrex) generate(pattern string) ([]string, error) {
+	if strings.TrimSpace(pattern) == "" {
+		return nil, errors.New("empty regex pattern")
+	}
 
-	args := []string{"--max-number", strconv.Itoa(e.MaxGenerated), pattern}
-	out, err := exec.CommandContext(ctx, e.resolvedExrexPath, args...).CombinedOutput()
+	re, err := syntax.Parse(pattern, syntax.Perl)
 	if err != nil {
-		msg := strings.TrimSpace(string(out))
-		if msg == "" {
-			msg = err.Error()
-		}
-		return nil, fmt.Errorf("exrex failed for %q: %s", pattern, msg)
+		return nil, fmt.Errorf("invalid regex %q: %w", pattern, err)
+	}
+
+	generated, err := enumerate(re.Simplify())
+	if err != nil {
+		return nil, fmt.Errorf("regex %q: %w", pattern, err)
 	}
 
-	lines := splitNonEmptyLines(string(out))
-	e.Cache[pattern] = lines
-	return lines, nil
+	generated = slicesx.Unique(generated)
+	if e.MaxGenerated > 0 && len(generated) > e.MaxGenerated {
+		generated = generated[:e.MaxGenerated]
+	}
+	return generated, nil
+}
+
+func enumerate(re *syntax.Regexp) ([]string, error) {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return nil, nil
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return []string{""}, nil
+	case syntax.OpLiteral:
+		return []string{strings.ToLower(string(re.Rune))}, nil
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		// host context: a bare '.' means the dot between labels
+		return []string{"."}, nil
+	case syntax.OpCharClass:
+		return charClass(re)
+	case syntax.OpCapture:
+		return enumerate(re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus:
+		return nil, ErrInfinite
+	case syntax.OpQuest:
+		sub, err := enumerate(re.Sub[0])
+		if err != nil {
+			return nil, err
+		}
+		return append([]string{""}, sub...), nil
+	case syntax.OpRepeat:
+		return repeat(re)
+	case syntax.OpConcat:
+		out := []string{""}
+		for _, s := range re.Sub {
+			sub, err := enumerate(s)
+			if err != nil {
+				return nil, err
+			}
+			if out, err = product(out, sub); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case syntax.OpAlternate:
+		var out []string
+		for _, s := range re.Sub {
+			sub, err := enumerate(s)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, sub...)
+			if len(out) > hardLimit {
+				return nil, ErrTooLarge
+			}
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported regex construct %q", re.String())
+	}
 }
 
-func resolveExecutable(name string) (string, error) {
-	// if name contains a path separator, treat as literal (absolute or relative).
-	if strings.ContainsRune(name, os.PathSeparator) {
-		if _, err := os.Stat(name); err == nil {
-			return name, nil
+func charClass(re *syntax.Regexp) ([]string, error) {
+	// hosts are case-insensitive, so [A-Za-z] only contributes 26 distinct strings
+	seen := make(map[rune]struct{})
+	var out []string
+	for i := 0; i+1 < len(re.Rune); i += 2 {
+		lo, hi := re.Rune[i], re.Rune[i+1]
+		if hi-lo >= hardLimit {
+			return nil, ErrTooLarge
+		}
+		for r := lo; r <= hi; r++ {
+			r := unicode.ToLower(r)
+			if _, ok := seen[r]; ok {
+				continue
+			}
+			seen[r] = struct{}{}
+			out = append(out, string(r))
+		}
+		if len(out) > hardLimit {
+			return nil, ErrTooLarge
 		}
-		return "", fmt.Errorf("not executable or not found: %q", name)
 	}
+	return out, nil
+}
 
-	// search PATH.
-	if p, err := exec.LookPath(name); err == nil {
-		return p, nil
+func repeat(re *syntax.Regexp) ([]string, error) {
+	if re.Max == -1 {
+		return nil, ErrInfinite
+	}
+	sub, err := enumerate(re.Sub[0])
+	if err != nil {
+		return nil, err
 	}
 
-	// try working directory
-	if cwd, err := os.Getwd(); err == nil {
-		candidate := filepath.Join(cwd, name)
-		if _, err := os.Stat(candidate); err == nil {
-			return candidate, nil
+	var out []string
+	current := []string{""}
+	for i := 0; i <= re.Max; i++ {
+		if i >= re.Min {
+			out = append(out, current...)
+			if len(out) > hardLimit {
+				return nil, ErrTooLarge
+			}
+		}
+		if i == re.Max {
+			break
+		}
+		if current, err = product(current, sub); err != nil {
+			return nil, err
 		}
 	}
-
-	return "", fmt.Errorf("executable %q not found in PATH or working directory", name)
+	return out, nil
 }
 
-func splitNonEmptyLines(s string) []string {
-	raw := strings.Split(s, "\n")
-	out := make([]string, 0, len(raw))
-	for _, v := range raw {
-		v = strings.TrimRight(v, "\r")
-		if v != "" {
-			out = append(out, v)
+func product(left, right []string) ([]string, error) {
+	if len(left)*len(right) > hardLimit {
+		return nil, ErrTooLarge
+	}
+	out := make([]string, 0, len(left)*len(right))
+	for _, l := range left {
+		for _, r := range right {
+			out = append(out, l+r)
 		}
 	}
-	return out
+	return out, nil
 }
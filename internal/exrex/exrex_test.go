@@ -0,0 +1,123 @@
+package exrex
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/config"
+)
+
+func newTestExrex(maxGenerated int) *Exrex {
+	var cfg config.Config
+	cfg.Regex.MaxGenerated = maxGenerated
+	return NewExrex(&cfg)
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{`^app\.example\.com$`, []string{"app.example.com"}},
+		{`(ha|haos|home-?assistant)\.example\.com`, []string{"ha.example.com", "haos.example.com", "homeassistant.example.com", "home-assistant.example.com"}},
+		// '.' is a literal dot in host context
+		{`^www.example.com$`, []string{"www.example.com"}},
+		{`^(app|app)\.example\.com$`, []string{"app.example.com"}},
+		{`^(?i)App\.example\.com$`, []string{"app.example.com"}},
+		{`^[a-c]x\.example\.com$`, []string{"ax.example.com", "bx.example.com", "cx.example.com"}},
+		// cut to MaxGenerated in enumeration order
+		{`^[a-c]{2}$`, []string{"aa", "ab", "ac", "ba", "bb"}},
+	}
+
+	e := newTestExrex(5)
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, err := e.Generate(tt.pattern)
+			if err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    error
+	}{
+		{`^.+\.dev\.example\.com$`, ErrInfinite},
+		{`^[a-z0-9-]*\.example\.com$`, ErrInfinite},
+		{`^[a-z]{10}\.example\.com$`, ErrTooLarge},
+	}
+
+	e := newTestExrex(5)
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if _, err := e.Generate(tt.pattern); !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if _, err := e.Generate(`^(app$`); err == nil {
+		t.Fatal("expected an error for an invalid regex")
+	}
+}
+
+func TestExrexSweepEvictsUnused(t *testing.T) {
+	e := newTestExrex(5)
+	_, _ = e.Generate(`^a\.example\.com$`)
+	_, _ = e.Generate(`^b\.example\.com$`)
+	if evicted := e.Sweep(); evicted != 0 {
+		t.Fatalf("expected nothing evicted right after use, got %d", evicted)
+	}
+
+	_, _ = e.Generate(`^a\.example\.com$`)
+	if evicted := e.Sweep(); evicted != 1 {
+		t.Fatalf("expected the unused pattern evicted, got %d", evicted)
+	}
+	if _, ok := e.cache[`^b\.example\.com$`]; ok {
+		t.Fatal("unused pattern is still cached")
+	}
+	if _, ok := e.cache[`^a\.example\.com$`]; !ok {
+		t.Fatal("used pattern was evicted")
+	}
+}
+
+func benchmarkPatterns(n int) []string {
+	patterns := make([]string, 0, n)
+	for i := range n {
+		patterns = append(patterns, fmt.Sprintf(`^(app|api|www)-?%d\.(example|test)\.com$`, i))
+	}
+	return patterns
+}
+
+func BenchmarkGenerateUncached(b *testing.B) {
+	patterns := benchmarkPatterns(3000)
+	e := newTestExrex(5)
+	for b.Loop() {
+		for _, pattern := range patterns {
+			_, _ = e.generate(pattern)
+		}
+	}
+}
+
+func BenchmarkGenerateCached(b *testing.B) {
+	patterns := benchmarkPatterns(3000)
+	e := newTestExrex(5)
+	for _, pattern := range patterns {
+		_, _ = e.Generate(pattern)
+	}
+	for b.Loop() {
+		// one sync cycle: every pattern looked up, then the sweep
+		for _, pattern := range patterns {
+			_, _ = e.Generate(pattern)
+		}
+		e.Sweep()
+	}
+}
@@ -1,10 +1,13 @@
 package model
 
+import "strings"
+
 type OpKind int
 
 const (
 	OpCreate OpKind = iota
 	OpDelete
+	OpUpdate
 )
 
 func (o OpKind) String() string {
@@ -13,25 +16,89 @@ func (o OpKind) String() string {
 		return "CREATE"
 	case OpDelete:
 		return "DELETE"
+	case OpUpdate:
+		return "UPDATE"
 	default:
 		return "UNKNOWN"
 	}
 }
 
+// Source describes where a desired alias came from
+type Source struct {
+	Router   string
+	Provider string
+	// Fragment is the part of the rule that produced the alias, e.g. Host(`app.example.com`)
+	Fragment string
+	// Regex is the HostRegexp pattern the alias was expanded from, if any
+	Regex string
+}
+
+func (s Source) String() string {
+	if s.Router == "" {
+		return s.Fragment
+	}
+	return s.Router + ": " + s.Fragment
+}
+
+type HostOverride struct {
+	UUID        string
+	Hostname    string
+	Domain      string
+	Description string
+}
+
+func (h *HostOverride) Key() string {
+	if h.Hostname == "" {
+		return h.Domain
+	}
+	return h.Hostname + "." + h.Domain
+}
+
 type HostAlias struct {
 	UUID        string
 	Hostname    string
 	Domain      string
 	Description string
+	// Target is the FQDN of the host override the alias belongs to, as configured
+	Target string
+	// Parent is the UUID of that host override
+	Parent string
+	// Enabled is false if the alias was disabled in OPNsense
+	Enabled bool
+	// Sources is only set on desired aliases
+	Sources []Source
 }
 
 func (h *HostAlias) Key() string {
+	// an empty hostname points the alias at the domain itself
+	if h.Hostname == "" {
+		return h.Domain
+	}
 	return h.Hostname + "." + h.Domain
 }
 
 type Operation struct {
-	Kind  OpKind
-	Alias HostAlias
+	Kind    OpKind
+	Alias   HostAlias
+	Sources []Source
+	// Reason optionally explains why the operation was planned, e.g. a compaction
+	Reason string
+}
+
+// Details returns the sources and reason of the operation for logging, or "" if there are none
+func (o *Operation) Details() string {
+	var details string
+	if len(o.Sources) > 0 {
+		parts := make([]string, 0, len(o.Sources))
+		for _, source := range o.Sources {
+			parts = append(parts, source.String())
+		}
+		details += " (" + strings.Join(parts, "; ") + ")"
+	}
+	if o.Reason != "" {
+		details += " [" + o.Reason + "]"
+	}
+	return details
 }
 
 type Plan struct {
@@ -44,7 +111,8 @@ func (p *Plan) IsEmpty() bool {
 
 func (p *Plan) AddOperation(kind OpKind, alias HostAlias) {
 	p.Operations = append(p.Operations, Operation{
-		Kind:  kind,
-		Alias: alias,
+		Kind:    kind,
+		Alias:   alias,
+		Sources: alias.Sources,
 	})
 }
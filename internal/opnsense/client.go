@@ -13,17 +13,20 @@ const (
 	searchHostOverrideApi = "/api/unbound/settings/search_host_override/"
 	searchHostAliasApi    = "/api/unbound/settings/search_host_alias/"
 	addHostAliasApi       = "/api/unbound/settings/add_host_alias/"
+	setHostAliasApi       = "/api/unbound/settings/set_host_alias/"
 	deleteHostAliasApi    = "/api/unbound/settings/del_host_alias/"
 	reconfigureApi        = "/api/unbound/service/reconfigure/"
 )
 
 type Client interface {
-	getHostOverrides(ctx context.Context) ([]hostOverride, error)
-	FindHostOverrideUUID(ctx context.Context, hostOverride string) (string, bool, error)
-	GetHostAliases(ctx context.Context, hostOverrideUUID string) ([]model.HostAlias, error)
+	GetHostOverrides(ctx context.Context) ([]model.HostOverride, error)
+	// GetHostAliases returns the aliases of every host override, with Parent set to the UUID of theirs
+	GetHostAliases(ctx context.Context) ([]model.HostAlias, error)
 	AddHostAlias(ctx context.Context, alias model.HostAlias, hostOverrideUUID string) (string, error)
+	SetHostAlias(ctx context.Context, alias model.HostAlias) error
 	DeleteHostAlias(ctx context.Context, alias model.HostAlias) error
-	ReconfigureUnbound(ctx context.Context) error
+	// Reconfigure applies the pending changes to the running DNS service
+	Reconfigure(ctx context.Context) error
 }
 
 type client struct {
@@ -42,7 +45,7 @@ func NewClient(baseURL string, verifyTls bool, apiKey, apiSecret string) Client
 	}
 }
 
-func (c *client) getHostOverrides(ctx context.Context) ([]hostOverride, error) {
+func (c *client) GetHostOverrides(ctx context.Context) ([]model.HostOverride, error) {
 	url := c.baseURL + searchHostOverrideApi
 
 	var resp searchHostResponse
@@ -50,32 +53,21 @@ func (c *client) getHostOverrides(ctx context.Context) ([]hostOverride, error) {
 		return nil, err
 	}
 
-	out := make([]hostOverride, 0, len(resp.Rows))
+	out := make([]model.HostOverride, 0, len(resp.Rows))
 	for _, r := range resp.Rows {
-		out = append(out, hostOverride{
-			UUID:     r.UUID,
-			Hostname: r.Hostname,
-			Domain:   r.Domain,
+		out = append(out, model.HostOverride{
+			UUID:        r.UUID,
+			Hostname:    r.Hostname,
+			Domain:      r.Domain,
+			Description: r.Description,
 		})
 	}
 	return out, nil
 }
 
-func (c *client) FindHostOverrideUUID(ctx context.Context, hostOverride string) (string, bool, error) {
-	items, err := c.getHostOverrides(ctx)
-	if err != nil {
-		return "", false, err
-	}
-	for _, item := range items {
-		if strings.EqualFold(item.Hostname+"."+item.Domain, hostOverride) {
-			return item.UUID, true, nil
-		}
-	}
-	return "", false, nil
-}
-
-func (c *client) GetHostAliases(ctx context.Context, hostOverrideUUID string) ([]model.HostAlias, error) {
-	url := c.baseURL + searchHostAliasApi + hostOverrideUUID
+func (c *client) GetHostAliases(ctx context.Context) ([]model.HostAlias, error) {
+	// without a host override UUID every alias is returned in one go
+	url := c.baseURL + searchHostAliasApi
 
 	var resp searchHostResponse
 	if err := httpx.JsonRequest(ctx, c.http, http.MethodGet, url, nil, &resp, c.apiKey, c.apiSecret); err != nil {
@@ -89,6 +81,8 @@ func (c *client) GetHostAliases(ctx context.Context, hostOverrideUUID string) ([
 			Hostname:    r.Hostname,
 			Domain:      r.Domain,
 			Description: r.Description,
+			Parent:      r.Host,
+			Enabled:     enabledFlag(r.Enabled),
 		})
 	}
 	return out, nil
@@ -98,7 +92,7 @@ func (c *client) AddHostAlias(ctx context.Context, alias model.HostAlias, hostOv
 	url := c.baseURL + addHostAliasApi
 
 	aliasCreate := hostAliasCreate{
-		Enabled:     "1",
+		Enabled:     enabledString(alias.Enabled),
 		Host:        hostOverrideUUID,
 		Hostname:    alias.Hostname,
 		Domain:      alias.Domain,
@@ -120,6 +114,28 @@ func (c *client) AddHostAlias(ctx context.Context, alias model.HostAlias, hostOv
 	return resp.UUID, nil
 }
 
+// SetHostAlias overwrites the alias with the given UUID, including the host override it belongs to
+func (c *client) SetHostAlias(ctx context.Context, alias model.HostAlias) error {
+	url := c.baseURL + setHostAliasApi + alias.UUID
+
+	aliasSet := hostAliasCreate{
+		Enabled:     enabledString(alias.Enabled),
+		Host:        alias.Parent,
+		Hostname:    alias.Hostname,
+		Domain:      alias.Domain,
+		Description: alias.Description,
+	}
+
+	type setReq struct {
+		Alias hostAliasCreate `json:"alias"`
+	}
+
+	if err := httpx.JsonRequest(ctx, c.http, http.MethodPost, url, setReq{Alias: aliasSet}, nil, c.apiKey, c.apiSecret); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (c *client) DeleteHostAlias(ctx context.Context, alias model.HostAlias) error {
 	url := c.baseURL + deleteHostAliasApi + alias.UUID
 
@@ -129,7 +145,7 @@ func (c *client) DeleteHostAlias(ctx context.Context, alias model.HostAlias) err
 	return nil
 }
 
-func (c *client) ReconfigureUnbound(ctx context.Context) error {
+func (c *client) Reconfigure(ctx context.Context) error {
 	url := c.baseURL + reconfigureApi
 
 	if err := httpx.JsonRequest(ctx, c.http, http.MethodPost, url, nil, nil, c.apiKey, c.apiSecret); err != nil {
@@ -0,0 +1,228 @@
+package opnsense
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/httpx"
+	"github.com/0x464e/traefik-opnsense-sync/internal/model"
+)
+
+const (
+	dnsmasqSearchHostApi  = "/api/dnsmasq/settings/search_host/"
+	dnsmasqSetHostApi     = "/api/dnsmasq/settings/set_host/"
+	dnsmasqReconfigureApi = "/api/dnsmasq/service/reconfigure/"
+
+	// aliasSeparator joins the UUID of a host and an alias name into the UUID of the alias,
+	// entries of an alias list have no UUID of their own
+	aliasSeparator = "/"
+	// commentSeparator separates the alias name from its description in the comments of a host
+	commentSeparator = ": "
+)
+
+// dnsmasqClient maps the host overrides and aliases of Unbound onto Dnsmasq. Host overrides
+// are Dnsmasq hosts and aliases are entries of their alias list. Entries of an alias list have no
+// description, so the description of each is kept as a "name: description" line in the comments
+// of the host. Dnsmasq hosts have no wildcard names, so wildcard aliases are not supported.
+type dnsmasqClient struct {
+	http      *http.Client
+	baseURL   string
+	apiKey    string
+	apiSecret string
+
+	// hosts from the last fetch, kept up to date by the alias list edits after it,
+	// since every edit rewrites the whole list
+	hosts []dnsmasqHost
+}
+
+func NewDnsmasqClient(baseURL string, verifyTls bool, apiKey, apiSecret string) Client {
+	return &dnsmasqClient{
+		http:      httpx.NewClient(verifyTls),
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+	}
+}
+
+func (c *dnsmasqClient) GetHostOverrides(ctx context.Context) ([]model.HostOverride, error) {
+	if err := c.fetchHosts(ctx); err != nil {
+		return nil, err
+	}
+
+	out := make([]model.HostOverride, 0, len(c.hosts))
+	for _, r := range c.hosts {
+		out = append(out, model.HostOverride{
+			UUID:        r.UUID,
+			Hostname:    r.Host,
+			Domain:      r.Domain,
+			Description: r.Description,
+		})
+	}
+	return out, nil
+}
+
+// GetHostAliases returns the entries of the alias lists of all hosts
+func (c *dnsmasqClient) GetHostAliases(ctx context.Context) ([]model.HostAlias, error) {
+	if err := c.fetchHosts(ctx); err != nil {
+		return nil, err
+	}
+
+	var out []model.HostAlias
+	for _, host := range c.hosts {
+		descriptions := aliasDescriptions(host.Comments)
+		for _, name := range splitList(host.Aliases) {
+			hostname, domain, _ := strings.Cut(name, ".")
+			out = append(out, model.HostAlias{
+				UUID:        host.UUID + aliasSeparator + name,
+				Hostname:    hostname,
+				Domain:      domain,
+				Description: descriptions[name],
+				Parent:      host.UUID,
+				// aliases of dnsmasq hosts cannot be disabled
+				Enabled: true,
+			})
+		}
+	}
+	return out, nil
+}
+
+// AddHostAlias adds the alias to the alias list of the host
+func (c *dnsmasqClient) AddHostAlias(ctx context.Context, alias model.HostAlias, hostOverrideUUID string) (string, error) {
+	name := alias.Key()
+	err := c.editAliases(ctx, hostOverrideUUID, func(names []string, comments string) ([]string, string) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+		return names, setAliasDescription(comments, name, alias.Description)
+	})
+	if err != nil {
+		return "", err
+	}
+	return hostOverrideUUID + aliasSeparator + name, nil
+}
+
+// SetHostAlias rewrites the description of the alias, moving it to the alias list of alias.Parent
+// if it is listed under another host
+func (c *dnsmasqClient) SetHostAlias(ctx context.Context, alias model.HostAlias) error {
+	host, name, _ := strings.Cut(alias.UUID, aliasSeparator)
+	if host != alias.Parent {
+		if err := c.removeAlias(ctx, host, name); err != nil {
+			return err
+		}
+	}
+	_, err := c.AddHostAlias(ctx, alias, alias.Parent)
+	return err
+}
+
+// DeleteHostAlias removes the alias from the alias list of its host
+func (c *dnsmasqClient) DeleteHostAlias(ctx context.Context, alias model.HostAlias) error {
+	host, name, _ := strings.Cut(alias.UUID, aliasSeparator)
+	return c.removeAlias(ctx, host, name)
+}
+
+func (c *dnsmasqClient) Reconfigure(ctx context.Context) error {
+	url := c.baseURL + dnsmasqReconfigureApi
+
+	if err := httpx.JsonRequest(ctx, c.http, http.MethodPost, url, nil, nil, c.apiKey, c.apiSecret); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *dnsmasqClient) removeAlias(ctx context.Context, hostUUID, name string) error {
+	return c.editAliases(ctx, hostUUID, func(names []string, comments string) ([]string, string) {
+		names = slices.DeleteFunc(names, func(n string) bool { return n == name })
+		return names, removeAliasDescription(comments, name)
+	})
+}
+
+// editAliases writes back the alias list and comments of a host after passing them through edit
+func (c *dnsmasqClient) editAliases(ctx context.Context, hostUUID string, edit func(names []string, comments string) ([]string, string)) error {
+	i := c.hostIndex(hostUUID)
+	if i < 0 {
+		return fmt.Errorf("dnsmasq host %s not found", hostUUID)
+	}
+
+	names, comments := edit(splitList(c.hosts[i].Aliases), c.hosts[i].Comments)
+
+	type setReq struct {
+		Host dnsmasqHostAliases `json:"host"`
+	}
+
+	// only the given fields are changed, the rest of the host is left as is
+	req := setReq{Host: dnsmasqHostAliases{Aliases: strings.Join(names, ","), Comments: comments}}
+	url := c.baseURL + dnsmasqSetHostApi + hostUUID
+	if err := httpx.JsonRequest(ctx, c.http, http.MethodPost, url, req, nil, c.apiKey, c.apiSecret); err != nil {
+		return err
+	}
+	c.hosts[i].Aliases = req.Host.Aliases
+	c.hosts[i].Comments = req.Host.Comments
+	return nil
+}
+
+func (c *dnsmasqClient) fetchHosts(ctx context.Context) error {
+	url := c.baseURL + dnsmasqSearchHostApi
+
+	var resp searchDnsmasqHostResponse
+	if err := httpx.JsonRequest(ctx, c.http, http.MethodGet, url, nil, &resp, c.apiKey, c.apiSecret); err != nil {
+		return err
+	}
+	c.hosts = resp.Rows
+	return nil
+}
+
+func (c *dnsmasqClient) hostIndex(uuid string) int {
+	return slices.IndexFunc(c.hosts, func(h dnsmasqHost) bool { return h.UUID == uuid })
+}
+
+// splitList splits a list field, which the API returns comma separated
+func splitList(list string) []string {
+	var out []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// aliasDescriptions reads the "name: description" lines from the comments of a host
+func aliasDescriptions(comments string) map[string]string {
+	descriptions := make(map[string]string)
+	for _, line := range strings.Split(comments, "\n") {
+		if name, description, ok := strings.Cut(strings.TrimSpace(line), commentSeparator); ok {
+			descriptions[name] = description
+		}
+	}
+	return descriptions
+}
+
+// setAliasDescription replaces or appends the comment line of an alias, other lines are kept
+func setAliasDescription(comments, name, description string) string {
+	line := name + commentSeparator + description
+	lines := splitLines(comments)
+	for i, l := range lines {
+		if strings.HasPrefix(l, name+commentSeparator) {
+			lines[i] = line
+			return strings.Join(lines, "\n")
+		}
+	}
+	return strings.Join(append(lines, line), "\n")
+}
+
+func removeAliasDescription(comments, name string) string {
+	lines := slices.DeleteFunc(splitLines(comments), func(l string) bool {
+		return strings.HasPrefix(l, name+commentSeparator)
+	})
+	return strings.Join(lines, "\n")
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(text, "\n"), "\n")
+}
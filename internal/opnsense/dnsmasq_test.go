@@ -0,0 +1,135 @@
+package opnsense
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/model"
+)
+
+func TestAliasDescriptions(t *testing.T) {
+	comments := "keep this note\napp.example.com: Managed | router app@docker\n  wiki.example.com: Managed  \nnot a description"
+
+	got := aliasDescriptions(comments)
+	want := map[string]string{
+		"app.example.com":  "Managed | router app@docker",
+		"wiki.example.com": "Managed",
+	}
+	for name, description := range want {
+		if got[name] != description {
+			t.Errorf("%s: expected %q, got %q", name, description, got[name])
+		}
+	}
+	if _, ok := got["keep this note"]; ok {
+		t.Error("a line without separator must not describe an alias")
+	}
+}
+
+func TestSetAliasDescription(t *testing.T) {
+	tests := []struct {
+		name     string
+		comments string
+		want     string
+	}{
+		{"empty", "", "app.example.com: Managed"},
+		{"appended", "keep this note", "keep this note\napp.example.com: Managed"},
+		{"replaced", "keep this note\napp.example.com: Old\nwiki.example.com: Managed", "keep this note\napp.example.com: Managed\nwiki.example.com: Managed"},
+		// a name that is a suffix of another must not match its line
+		{"other name", "myapp.example.com: Managed", "myapp.example.com: Managed\napp.example.com: Managed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := setAliasDescription(tt.comments, "app.example.com", "Managed"); got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRemoveAliasDescription(t *testing.T) {
+	comments := "keep this note\napp.example.com: Managed\nmyapp.example.com: Managed"
+	want := "keep this note\nmyapp.example.com: Managed"
+	if got := removeAliasDescription(comments, "app.example.com"); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+// fakeDnsmasq serves the host search and records the set_host requests
+type fakeDnsmasq struct {
+	hosts []dnsmasqHost
+	sets  []dnsmasqHostAliases
+}
+
+func (f *fakeDnsmasq) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == dnsmasqSearchHostApi:
+		_ = json.NewEncoder(w).Encode(searchDnsmasqHostResponse{Rows: f.hosts})
+	case strings.HasPrefix(r.URL.Path, dnsmasqSetHostApi):
+		var req struct {
+			Host dnsmasqHostAliases `json:"host"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.sets = append(f.sets, req.Host)
+		uuid := strings.TrimPrefix(r.URL.Path, dnsmasqSetHostApi)
+		for i := range f.hosts {
+			if f.hosts[i].UUID == uuid {
+				f.hosts[i].Aliases = req.Host.Aliases
+				f.hosts[i].Comments = req.Host.Comments
+			}
+		}
+		_, _ = w.Write([]byte(`{"result":"saved"}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestDnsmasqClientAliases(t *testing.T) {
+	fake := &fakeDnsmasq{hosts: []dnsmasqHost{{
+		UUID:     "h1",
+		Host:     "proxy",
+		Domain:   "example.com",
+		IP:       "10.0.0.5",
+		Aliases:  "manual.example.com,app.example.com",
+		Comments: "keep this note\napp.example.com: Managed",
+	}}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	c := NewDnsmasqClient(server.URL, true, "key", "secret")
+	ctx := context.Background()
+
+	// aliases are fetched on their own, without GetHostOverrides first
+	aliases, err := c.GetHostAliases(ctx)
+	if err != nil {
+		t.Fatalf("GetHostAliases: %v", err)
+	}
+	if len(aliases) != 2 {
+		t.Fatalf("expected 2 aliases, got %+v", aliases)
+	}
+	if aliases[0].Key() != "manual.example.com" || aliases[0].Description != "" || aliases[0].Parent != "h1" {
+		t.Errorf("unexpected unmanaged alias %+v", aliases[0])
+	}
+	if aliases[1].UUID != "h1/app.example.com" || aliases[1].Description != "Managed" {
+		t.Errorf("unexpected managed alias %+v", aliases[1])
+	}
+
+	uuid, err := c.AddHostAlias(ctx, model.HostAlias{Hostname: "wiki", Domain: "example.com", Description: "Managed"}, "h1")
+	if err != nil {
+		t.Fatalf("AddHostAlias: %v", err)
+	}
+	if err := c.DeleteHostAlias(ctx, aliases[1]); err != nil {
+		t.Fatalf("DeleteHostAlias: %v", err)
+	}
+
+	if uuid != "h1/wiki.example.com" {
+		t.Errorf("unexpected UUID %q", uuid)
+	}
+	// every edit builds on the previous one
+	want := dnsmasqHostAliases{Aliases: "manual.example.com,wiki.example.com", Comments: "keep this note\nwiki.example.com: Managed"}
+	if last := fake.sets[len(fake.sets)-1]; last != want {
+		t.Fatalf("expected %+v, got %+v", want, last)
+	}
+}
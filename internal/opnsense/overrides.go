@@ -0,0 +1,194 @@
+package opnsense
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/httpx"
+	"github.com/0x464e/traefik-opnsense-sync/internal/model"
+)
+
+const (
+	addHostOverrideApi    = "/api/unbound/settings/add_host_override/"
+	setHostOverrideApi    = "/api/unbound/settings/set_host_override/"
+	deleteHostOverrideApi = "/api/unbound/settings/del_host_override/"
+
+	// addressPrefix marks the UUID of an address standing in for a parent host override
+	addressPrefix = "address:"
+)
+
+// overrideClient manages A/AAAA host overrides directly instead of aliases. Every address takes
+// the place of a parent host override, its aliases are the host overrides pointing to it.
+// Configured addresses are named after their target, other addresses found in OPNsense after
+// the address itself, so records left at an old address are moved to the current one.
+type overrideClient struct {
+	http      *http.Client
+	baseURL   string
+	apiKey    string
+	apiSecret string
+
+	// addresses maps each target to its IP
+	addresses map[string]string
+}
+
+func NewOverrideClient(baseURL string, verifyTls bool, apiKey, apiSecret string, addresses map[string]string) Client {
+	return &overrideClient{
+		http:      httpx.NewClient(verifyTls),
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+		addresses: addresses,
+	}
+}
+
+// GetHostOverrides returns one entry per address, not the host overrides in OPNsense
+func (c *overrideClient) GetHostOverrides(ctx context.Context) ([]model.HostOverride, error) {
+	rows, err := c.fetchRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []model.HostOverride
+	configured := make(map[string]struct{}, len(c.addresses))
+	for target, ip := range c.addresses {
+		// Key() of the entry is the target itself
+		out = append(out, model.HostOverride{UUID: addressPrefix + ip, Domain: target})
+		configured[ip] = struct{}{}
+	}
+	for _, r := range rows {
+		ip, ok := address(r)
+		if !ok {
+			continue
+		}
+		if _, ok := configured[ip]; ok {
+			continue
+		}
+		configured[ip] = struct{}{}
+		out = append(out, model.HostOverride{UUID: addressPrefix + ip, Domain: ip})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].UUID < out[j].UUID
+	})
+	return out, nil
+}
+
+// GetHostAliases returns the A/AAAA host overrides, each under its address
+func (c *overrideClient) GetHostAliases(ctx context.Context) ([]model.HostAlias, error) {
+	rows, err := c.fetchRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []model.HostAlias
+	for _, r := range rows {
+		ip, ok := address(r)
+		if !ok {
+			continue
+		}
+		out = append(out, model.HostAlias{
+			UUID:        r.UUID,
+			Hostname:    r.Hostname,
+			Domain:      r.Domain,
+			Description: r.Description,
+			Parent:      addressPrefix + ip,
+			Enabled:     enabledFlag(r.Enabled),
+		})
+	}
+	return out, nil
+}
+
+func (c *overrideClient) AddHostAlias(ctx context.Context, alias model.HostAlias, hostOverrideUUID string) (string, error) {
+	url := c.baseURL + addHostOverrideApi
+
+	type addReq struct {
+		Host hostOverrideCreate `json:"host"`
+	}
+	type addResp struct {
+		Result string `json:"result"`
+		UUID   string `json:"uuid,omitempty"`
+	}
+
+	var resp addResp
+	req := addReq{Host: newHostOverrideCreate(alias, hostOverrideUUID)}
+	if err := httpx.JsonRequest(ctx, c.http, http.MethodPost, url, req, &resp, c.apiKey, c.apiSecret); err != nil {
+		return "", err
+	}
+	return resp.UUID, nil
+}
+
+// SetHostAlias overwrites the host override, pointing it to the address of alias.Parent
+func (c *overrideClient) SetHostAlias(ctx context.Context, alias model.HostAlias) error {
+	url := c.baseURL + setHostOverrideApi + alias.UUID
+
+	type setReq struct {
+		Host hostOverrideCreate `json:"host"`
+	}
+
+	req := setReq{Host: newHostOverrideCreate(alias, alias.Parent)}
+	if err := httpx.JsonRequest(ctx, c.http, http.MethodPost, url, req, nil, c.apiKey, c.apiSecret); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *overrideClient) DeleteHostAlias(ctx context.Context, alias model.HostAlias) error {
+	url := c.baseURL + deleteHostOverrideApi + alias.UUID
+
+	if err := httpx.JsonRequest(ctx, c.http, http.MethodPost, url, nil, nil, c.apiKey, c.apiSecret); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *overrideClient) Reconfigure(ctx context.Context) error {
+	url := c.baseURL + reconfigureApi
+
+	if err := httpx.JsonRequest(ctx, c.http, http.MethodPost, url, nil, nil, c.apiKey, c.apiSecret); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *overrideClient) fetchRows(ctx context.Context) ([]hostOverrideRow, error) {
+	url := c.baseURL + searchHostOverrideApi
+
+	var resp searchHostOverrideResponse
+	if err := httpx.JsonRequest(ctx, c.http, http.MethodGet, url, nil, &resp, c.apiKey, c.apiSecret); err != nil {
+		return nil, err
+	}
+	return resp.Rows, nil
+}
+
+func newHostOverrideCreate(alias model.HostAlias, hostOverrideUUID string) hostOverrideCreate {
+	ip := strings.TrimPrefix(hostOverrideUUID, addressPrefix)
+	rr := "A"
+	if addr, err := netip.ParseAddr(ip); err == nil && addr.Is6() {
+		rr = "AAAA"
+	}
+	return hostOverrideCreate{
+		Enabled:     enabledString(alias.Enabled),
+		Hostname:    alias.Hostname,
+		Domain:      alias.Domain,
+		RR:          rr,
+		Server:      ip,
+		Description: alias.Description,
+	}
+}
+
+// address returns the normalized IP of an A/AAAA host override
+func address(r hostOverrideRow) (string, bool) {
+	// search results show the record type with its description, e.g. "A (IPv4 address)"
+	rr, _, _ := strings.Cut(r.RR, " ")
+	if rr != "A" && rr != "AAAA" {
+		return "", false
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(r.Server))
+	if err != nil {
+		return "", false
+	}
+	return addr.String(), true
+}
@@ -0,0 +1,105 @@
+package opnsense
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/model"
+)
+
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		rr, server string
+		want       string
+		ok         bool
+	}{
+		{"A (IPv4 address)", "10.0.0.5", "10.0.0.5", true},
+		{"A", " 10.0.0.5 ", "10.0.0.5", true},
+		// IPv6 addresses are normalized, so the same address always has the same parent
+		{"AAAA (IPv6 address)", "2001:DB8:0:0::5", "2001:db8::5", true},
+		{"MX (Mail server)", "mail.example.com", "", false},
+		{"A (IPv4 address)", "not an address", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rr+" "+tt.server, func(t *testing.T) {
+			got, ok := address(hostOverrideRow{RR: tt.rr, Server: tt.server})
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("expected %q %v, got %q %v", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestNewHostOverrideCreate(t *testing.T) {
+	alias := model.HostAlias{Hostname: "app", Domain: "example.com", Enabled: true}
+	for parent, want := range map[string]hostOverrideCreate{
+		"address:10.0.0.5":    {Enabled: "1", Hostname: "app", Domain: "example.com", RR: "A", Server: "10.0.0.5"},
+		"address:2001:db8::5": {Enabled: "1", Hostname: "app", Domain: "example.com", RR: "AAAA", Server: "2001:db8::5"},
+	} {
+		if got := newHostOverrideCreate(alias, parent); got != want {
+			t.Errorf("%s: expected %+v, got %+v", parent, want, got)
+		}
+	}
+}
+
+func TestOverrideClientAddressParents(t *testing.T) {
+	rows := []hostOverrideRow{
+		{UUID: "o1", Enabled: "1", Hostname: "app", Domain: "example.com", RR: "A (IPv4 address)", Server: "10.0.0.5"},
+		{UUID: "o2", Enabled: "1", Hostname: "app", Domain: "example.com", RR: "AAAA (IPv6 address)", Server: "2001:db8::5"},
+		{UUID: "o3", Enabled: "0", Hostname: "old", Domain: "example.com", RR: "A (IPv4 address)", Server: "10.0.0.9"},
+		{UUID: "o4", Enabled: "1", Hostname: "", Domain: "example.com", RR: "MX (Mail server)", Server: "mail.example.com"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != searchHostOverrideApi {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(searchHostOverrideResponse{Rows: rows})
+	}))
+	defer server.Close()
+	c := NewOverrideClient(server.URL, true, "key", "secret", map[string]string{
+		"proxy.example.com":  "10.0.0.5",
+		"proxy6.example.com": "2001:db8::5",
+	})
+	ctx := context.Background()
+
+	// aliases are fetched on their own, without GetHostOverrides first
+	aliases, err := c.GetHostAliases(ctx)
+	if err != nil {
+		t.Fatalf("GetHostAliases: %v", err)
+	}
+	wantParents := map[string]string{"o1": "address:10.0.0.5", "o2": "address:2001:db8::5", "o3": "address:10.0.0.9"}
+	if len(aliases) != len(wantParents) {
+		t.Fatalf("expected %d aliases, got %+v", len(wantParents), aliases)
+	}
+	for _, alias := range aliases {
+		if alias.Parent != wantParents[alias.UUID] {
+			t.Errorf("%s: expected parent %s, got %s", alias.UUID, wantParents[alias.UUID], alias.Parent)
+		}
+	}
+	if aliases[2].Enabled {
+		t.Error("expected the disabled host override to be a disabled alias")
+	}
+
+	overrides, err := c.GetHostOverrides(ctx)
+	if err != nil {
+		t.Fatalf("GetHostOverrides: %v", err)
+	}
+	// configured addresses are named after their target, others after the address
+	want := []model.HostOverride{
+		{UUID: "address:10.0.0.5", Domain: "proxy.example.com"},
+		{UUID: "address:10.0.0.9", Domain: "10.0.0.9"},
+		{UUID: "address:2001:db8::5", Domain: "proxy6.example.com"},
+	}
+	if len(overrides) != len(want) {
+		t.Fatalf("expected %+v, got %+v", want, overrides)
+	}
+	for i := range want {
+		if overrides[i] != want[i] {
+			t.Errorf("expected %+v, got %+v", want[i], overrides[i])
+		}
+	}
+}
@@ -2,7 +2,10 @@ package opnsense
 
 type searchHostResponse struct {
 	Rows []struct {
-		UUID        string `json:"uuid"`
+		UUID    string `json:"uuid"`
+		Enabled string `json:"enabled"`
+		// Host is the UUID of the host override an alias belongs to
+		Host        string `json:"host"`
 		Hostname    string `json:"hostname"`
 		Domain      string `json:"domain"`
 		Description string `json:"description"`
@@ -17,8 +20,56 @@ type hostAliasCreate struct {
 	Description string `json:"description"`
 }
 
-type hostOverride struct {
-	UUID     string
-	Hostname string
-	Domain   string
+type dnsmasqHost struct {
+	UUID        string `json:"uuid"`
+	Host        string `json:"host"`
+	Domain      string `json:"domain"`
+	IP          string `json:"ip"`
+	Aliases     string `json:"aliases"`
+	Description string `json:"descr"`
+	Comments    string `json:"comments"`
+}
+
+type searchDnsmasqHostResponse struct {
+	Rows []dnsmasqHost `json:"rows"`
+}
+
+type dnsmasqHostAliases struct {
+	Aliases  string `json:"aliases"`
+	Comments string `json:"comments"`
+}
+
+type searchHostOverrideResponse struct {
+	Rows []hostOverrideRow `json:"rows"`
+}
+
+type hostOverrideRow struct {
+	UUID        string `json:"uuid"`
+	Enabled     string `json:"enabled"`
+	Hostname    string `json:"hostname"`
+	Domain      string `json:"domain"`
+	RR          string `json:"rr"`
+	Server      string `json:"server"`
+	Description string `json:"description"`
+}
+
+type hostOverrideCreate struct {
+	Enabled     string `json:"enabled"`
+	Hostname    string `json:"hostname"`
+	Domain      string `json:"domain"`
+	RR          string `json:"rr"`
+	Server      string `json:"server"`
+	Description string `json:"description"`
+}
+
+// enabledFlag converts the enabled flag of a row, a missing flag means enabled
+func enabledFlag(enabled string) bool {
+	return enabled != "0"
+}
+
+func enabledString(enabled bool) string {
+	if enabled {
+		return "1"
+	}
+	return "0"
 }
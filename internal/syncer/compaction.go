@@ -0,0 +1,213 @@
+package syncer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/config"
+	"github.com/0x464e/traefik-opnsense-sync/internal/model"
+)
+
+// compactor replaces many aliases under one subdomain with a single wildcard alias
+type compactor struct {
+	enabled   bool
+	threshold int
+	// zones are never compacted, a wildcard there would cover the host overrides and every
+	// hand-made name in the zone. They include the domains of the targets themselves.
+	zones map[string]struct{}
+}
+
+func newCompactor(cfg *config.Config, zoneSplitter *zoneSplitter) *compactor {
+	zones := make(map[string]struct{}, len(zoneSplitter.zones))
+	for _, zone := range zoneSplitter.zones {
+		zones[zone] = struct{}{}
+	}
+	return &compactor{
+		enabled:   cfg.Reconcile.Compaction.Enabled,
+		threshold: cfg.Reconcile.Compaction.Threshold,
+		zones:     zones,
+	}
+}
+
+type compactionGroup struct {
+	target  string
+	parent  string
+	domain  string
+	aliases []model.HostAlias
+}
+
+// compact replaces every group of at least threshold aliases directly under the same subdomain
+// and host override with a "*" alias. A group is left alone when other names under its subdomain
+// are desired under another host override or exist unmanaged, since the wildcard would shadow
+// those exceptions. Compacted groups are recorded into result.
+func (c *compactor) compact(aliases []model.HostAlias, unmanaged map[string][]unmanagedEntry, result *Result) []model.HostAlias {
+	if !c.enabled {
+		return aliases
+	}
+
+	groups := make(map[string]*compactionGroup)
+	var order []string
+	for _, alias := range aliases {
+		domain, ok := c.compactable(alias)
+		if !ok {
+			continue
+		}
+		key := alias.Target + "|" + domain
+		group, ok := groups[key]
+		if !ok {
+			group = &compactionGroup{target: alias.Target, parent: alias.Parent, domain: domain}
+			groups[key] = group
+			order = append(order, key)
+		}
+		group.aliases = append(group.aliases, alias)
+	}
+
+	compacted := make(map[string]model.HostAlias)
+	for _, key := range order {
+		group := groups[key]
+		if len(group.aliases) < c.threshold || hasException(group, aliases, unmanaged) {
+			continue
+		}
+
+		wildcard := model.HostAlias{
+			Hostname:    "*",
+			Domain:      group.domain,
+			Description: group.aliases[0].Description,
+			Target:      group.target,
+			Parent:      group.parent,
+			Enabled:     true,
+		}
+		compaction := Compaction{Target: group.target, Domain: group.domain}
+		for _, alias := range group.aliases {
+			wildcard.Sources = append(wildcard.Sources, alias.Sources...)
+			compaction.Names = append(compaction.Names, alias.Key())
+		}
+		sort.Strings(compaction.Names)
+		compacted[key] = wildcard
+		result.Compactions = append(result.Compactions, compaction)
+	}
+	if len(compacted) == 0 {
+		return aliases
+	}
+
+	// an explicit wildcard for a compacted domain, e.g. from a HostRegexp, merges into the compacted one
+	for _, alias := range aliases {
+		key := alias.Target + "|" + alias.Domain
+		if wildcard, ok := compacted[key]; ok && alias.Hostname == "*" {
+			wildcard.Sources = append(wildcard.Sources, alias.Sources...)
+			compacted[key] = wildcard
+		}
+	}
+
+	out := make([]model.HostAlias, 0, len(aliases))
+	emitted := make(map[string]bool, len(compacted))
+	for _, alias := range aliases {
+		domain := alias.Domain
+		if alias.Hostname != "*" {
+			domain, _ = c.compactable(alias)
+		}
+		key := alias.Target + "|" + domain
+		wildcard, ok := compacted[key]
+		if !ok {
+			out = append(out, alias)
+			continue
+		}
+		if !emitted[key] {
+			emitted[key] = true
+			out = append(out, wildcard)
+		}
+	}
+	return out
+}
+
+// compactedInto returns the wildcard an alias from OPNsense was compacted into, if any
+func (c *compactor) compactedInto(alias model.HostAlias, result *Result) (string, bool) {
+	domain, ok := c.compactable(alias)
+	if !ok {
+		return "", false
+	}
+	for _, compaction := range result.Compactions {
+		if compaction.Target == alias.Target && compaction.Domain == domain {
+			return "*." + compaction.Domain, true
+		}
+	}
+	return "", false
+}
+
+// compactable returns the subdomain an alias would be compacted under: its name without the
+// first label, however the name was split. Names directly under a zone are never compacted.
+func (c *compactor) compactable(alias model.HostAlias) (string, bool) {
+	if alias.Hostname == "" || alias.Hostname == "*" {
+		return "", false
+	}
+	_, domain, found := strings.Cut(alias.Key(), ".")
+	if !found || !strings.Contains(domain, ".") {
+		return "", false
+	}
+	if _, zone := c.zones[domain]; zone {
+		return "", false
+	}
+	return domain, true
+}
+
+// hasException reports whether other names under the domain of the group would be shadowed by
+// its wildcard: names desired under another target, or unmanaged ones under a host override
+// the names of the group are not desired under
+func hasException(group *compactionGroup, aliases []model.HostAlias, unmanaged map[string][]unmanagedEntry) bool {
+	ours := make(map[string]struct{}, len(group.aliases))
+	for _, alias := range aliases {
+		if alias.Target == group.target {
+			ours[alias.Key()] = struct{}{}
+		}
+	}
+	// the other host overrides of a dual-stack target answer for the same names
+	parents := make(map[string]struct{})
+	desiredParents := parentsByKey(aliases)
+	for _, alias := range group.aliases {
+		for parent := range desiredParents[alias.Key()] {
+			parents[parent] = struct{}{}
+		}
+	}
+	for _, alias := range aliases {
+		if alias.Target == group.target {
+			continue
+		}
+		key := alias.Key()
+		if key != group.domain && !strings.HasSuffix(key, "."+group.domain) {
+			continue
+		}
+		if _, ok := ours[key]; !ok {
+			return true
+		}
+	}
+
+	for key, entries := range unmanaged {
+		if !strings.HasSuffix(key, "."+group.domain) {
+			continue
+		}
+		for _, entry := range entries {
+			if _, ok := parents[entry.parent]; !ok || entry.parent == "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c Compaction) String() string {
+	return fmt.Sprintf("%d names under %s → *.%s (%s)", len(c.Names), c.Domain, c.Domain, c.Target)
+}
+
+// compactionOf returns the compaction a desired wildcard alias stands for, if any
+func (r *Result) compactionOf(alias model.HostAlias) (Compaction, bool) {
+	if alias.Hostname != "*" {
+		return Compaction{}, false
+	}
+	for _, compaction := range r.Compactions {
+		if compaction.Target == alias.Target && compaction.Domain == alias.Domain {
+			return compaction, true
+		}
+	}
+	return Compaction{}, false
+}
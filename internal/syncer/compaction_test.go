@@ -0,0 +1,124 @@
+package syncer
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/model"
+)
+
+func newCompactionEngine(t *testing.T) *Engine {
+	return newTestEngine(t, map[string]any{
+		"reconcile": map[string]any{
+			"compaction": map[string]any{"enabled": true, "threshold": 3},
+		},
+	})
+}
+
+func compactionRules(names ...string) map[string]string {
+	rules := make(map[string]string, len(names))
+	for i, name := range names {
+		rules[fmt.Sprintf("r%d@docker", i)] = "Host(`" + name + "`)"
+	}
+	return rules
+}
+
+func planKeys(result *Result, kind model.OpKind) []string {
+	var keys []string
+	for _, op := range result.Plan.Operations {
+		if op.Kind == kind {
+			keys = append(keys, op.Alias.Key())
+		}
+	}
+	return keys
+}
+
+func TestCompactionGroupsSubdomainsBelowZone(t *testing.T) {
+	e := newCompactionEngine(t)
+	snapshot := testSnapshot(compactionRules("a.apps.example.com", "b.apps.example.com", "c.apps.example.com"))
+	parents := map[string]string{"proxy.example.com": "proxy-uuid"}
+
+	result, err := e.computePlan(snapshot, nil, nil, parents)
+	if err != nil {
+		t.Fatalf("computePlan: %v", err)
+	}
+	if creates := planKeys(result, model.OpCreate); !slices.Equal(creates, []string{"*.apps.example.com"}) {
+		t.Fatalf("expected a single *.apps.example.com, got %v", creates)
+	}
+
+	// the explicit aliases of a compacted group are deleted in favour of the wildcard
+	aliases := []model.HostAlias{managedAlias("a1", "a.apps", "example.com", "proxy.example.com", "proxy-uuid")}
+	result, err = e.computePlan(snapshot, aliases, nil, parents)
+	if err != nil {
+		t.Fatalf("computePlan: %v", err)
+	}
+	if deletes := planKeys(result, model.OpDelete); !slices.Equal(deletes, []string{"a.apps.example.com"}) {
+		t.Fatalf("expected a.apps.example.com to be deleted, got %v", deletes)
+	}
+}
+
+func TestCompactionSkipsZones(t *testing.T) {
+	e := newCompactionEngine(t)
+	snapshot := testSnapshot(compactionRules("a.example.com", "b.example.com", "c.example.com"))
+
+	result, err := e.computePlan(snapshot, nil, nil, map[string]string{"proxy.example.com": "proxy-uuid"})
+	if err != nil {
+		t.Fatalf("computePlan: %v", err)
+	}
+	if len(result.Compactions) != 0 {
+		t.Fatalf("expected nothing compacted at the zone root, got %v", result.Compactions)
+	}
+	if creates := planKeys(result, model.OpCreate); len(creates) != 3 {
+		t.Fatalf("expected the three names created as they are, got %v", creates)
+	}
+}
+
+func TestCompactionKeepsUnmanagedExceptions(t *testing.T) {
+	e := newCompactionEngine(t)
+	snapshot := testSnapshot(compactionRules("a.apps.example.com", "b.apps.example.com", "c.apps.example.com"))
+	parents := map[string]string{"proxy.example.com": "proxy-uuid"}
+	hostOverrides := []model.HostOverride{
+		{UUID: "proxy-uuid", Hostname: "proxy", Domain: "example.com"},
+		{UUID: "nas-uuid", Hostname: "nas.apps", Domain: "example.com"},
+	}
+
+	result, err := e.computePlan(snapshot, nil, hostOverrides, parents)
+	if err != nil {
+		t.Fatalf("computePlan: %v", err)
+	}
+	if len(result.Compactions) != 0 {
+		t.Fatalf("expected nothing compacted next to the unmanaged nas.apps.example.com, got %v", result.Compactions)
+	}
+
+	// an unmanaged alias under the same host override answers with the same address
+	aliases := []model.HostAlias{{UUID: "u1", Hostname: "manual.apps", Domain: "example.com", Target: "proxy.example.com", Parent: "proxy-uuid", Enabled: true}}
+	result, err = e.computePlan(snapshot, aliases, nil, parents)
+	if err != nil {
+		t.Fatalf("computePlan: %v", err)
+	}
+	if len(result.Compactions) != 1 {
+		t.Fatalf("expected the group compacted, got %v", result.Compactions)
+	}
+}
+
+func TestCompactionDualStackTarget(t *testing.T) {
+	e := newTestEngine(t, map[string]any{
+		"opnsense": map[string]any{"host_override": []string{"proxy.example.com", "proxy6.example.com"}},
+		"reconcile": map[string]any{
+			"compaction": map[string]any{"enabled": true, "threshold": 3},
+		},
+	})
+	snapshot := testSnapshot(compactionRules("a.apps.example.com", "b.apps.example.com", "c.apps.example.com"))
+	parents := map[string]string{"proxy.example.com": "proxy-uuid", "proxy6.example.com": "proxy6-uuid"}
+	// a hand-made alias under the AAAA record answers like the target itself
+	aliases := []model.HostAlias{{UUID: "u1", Hostname: "manual.apps", Domain: "example.com", Target: "proxy6.example.com", Parent: "proxy6-uuid", Enabled: true}}
+
+	result, err := e.computePlan(snapshot, aliases, nil, parents)
+	if err != nil {
+		t.Fatalf("computePlan: %v", err)
+	}
+	if len(result.Compactions) != 2 {
+		t.Fatalf("expected the group compacted under both records, got %v", result.Compactions)
+	}
+}
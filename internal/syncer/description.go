@@ -0,0 +1,126 @@
+package syncer
+
+import (
+	"log"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/config"
+	"github.com/0x464e/traefik-opnsense-sync/internal/model"
+)
+
+// markerSeparator separates the ownership marker from the rendered part of a description
+const markerSeparator = " | "
+
+// describer renders alias descriptions and decides ownership from them. Ownership only depends
+// on the description tag used as a marker, so the rendered part is free to change.
+type describer struct {
+	tag string
+	// legacy are previous description tags, aliases carrying them are migrated to tag
+	legacy   []string
+	template *template.Template
+	suffix   bool
+}
+
+// DescriptionData is what the description template can access
+type DescriptionData struct {
+	// Name is the full alias name, e.g. app.example.com
+	Name      string
+	Hostname  string
+	Domain    string
+	Target    string
+	Routers   []string
+	Providers []string
+	Sources   []model.Source
+	// Date is the day the alias was created, as YYYY-MM-DD
+	Date string
+}
+
+func newDescriber(cfg *config.Config) *describer {
+	d := &describer{
+		tag:    cfg.Reconcile.DescriptionTag,
+		legacy: cfg.Reconcile.LegacyDescriptionTags,
+		suffix: cfg.Reconcile.Description.Marker == "suffix",
+	}
+	if cfg.Reconcile.Description.Template != "" {
+		// validated on config load
+		d.template, _ = cfg.Reconcile.Description.ParseTemplate()
+	}
+	return d
+}
+
+// owns reports whether a description carries the marker of the current or a legacy tag
+func (d *describer) owns(description string) bool {
+	if hasMarker(description, d.tag) {
+		return true
+	}
+	_, legacy := d.migrate(description)
+	return legacy
+}
+
+// migrate replaces a legacy tag in the description with the current one, keeping the rest.
+// The bool is false if the description carries no legacy tag.
+func (d *describer) migrate(description string) (string, bool) {
+	for _, legacy := range d.legacy {
+		switch {
+		case description == legacy:
+			return d.tag, true
+		case strings.HasPrefix(description, legacy+markerSeparator):
+			return d.tag + strings.TrimPrefix(description, legacy), true
+		case strings.HasSuffix(description, markerSeparator+legacy):
+			return strings.TrimSuffix(description, legacy) + d.tag, true
+		}
+	}
+	return "", false
+}
+
+// hasMarker reports whether a description carries the tag in either position. Descriptions
+// consisting of the bare tag, as written before templates existed, count as well.
+func hasMarker(description, tag string) bool {
+	return description == tag ||
+		strings.HasPrefix(description, tag+markerSeparator) ||
+		strings.HasSuffix(description, markerSeparator+tag)
+}
+
+// describe renders the description of an alias about to be created. Without a template, or
+// if rendering fails or produces nothing, the description is the bare tag.
+func (d *describer) describe(alias model.HostAlias, now time.Time) string {
+	if d.template == nil {
+		return d.tag
+	}
+
+	data := DescriptionData{
+		Name:     alias.Key(),
+		Hostname: alias.Hostname,
+		Domain:   alias.Domain,
+		Target:   alias.Target,
+		Sources:  alias.Sources,
+		Date:     now.Format(time.DateOnly),
+	}
+	for _, source := range alias.Sources {
+		if source.Router != "" && !slices.Contains(data.Routers, source.Router) {
+			data.Routers = append(data.Routers, source.Router)
+		}
+		if source.Provider != "" && !slices.Contains(data.Providers, source.Provider) {
+			data.Providers = append(data.Providers, source.Provider)
+		}
+	}
+
+	var b strings.Builder
+	if err := d.template.Execute(&b, data); err != nil {
+		log.Printf("[Warning] failed to render description of %s, using the description tag only: %v", alias.Key(), err)
+		return d.tag
+	}
+	// descriptions are single-line in OPNsense
+	rendered := strings.Join(strings.Fields(b.String()), " ")
+	if rendered == "" {
+		return d.tag
+	}
+
+	if d.suffix {
+		return rendered + markerSeparator + d.tag
+	}
+	return d.tag + markerSeparator + rendered
+}
@@ -1,225 +1,777 @@
 package syncer
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"slices"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/0x464e/traefik-opnsense-sync/internal/config"
-	"github.com/0x464e/traefik-opnsense-sync/internal/exrex"
+	"github.com/0x464e/traefik-opnsense-sync/internal/dnsname"
 	"github.com/0x464e/traefik-opnsense-sync/internal/model"
 	"github.com/0x464e/traefik-opnsense-sync/internal/traefik"
 )
 
 type Engine struct {
-	regexGenerator     *exrex.Exrex
+	ruleCache          *traefik.RuleCache
+	regexExpander      *regexExpander
+	zoneSplitter       *zoneSplitter
+	targetMapper       *targetMapper
+	rewriter           *rewriter
+	compactor          *compactor
+	describer          *describer
+	adoption           string
+	repairDisabled     bool
+	conflictPolicy     string
+	protected          *protectedDomains
+	wildcards          bool
+	abortOnParseError  bool
 	includeEntryPoints []string
 	ignoreRouters      []string
 	includeProviders   []string
 	ignoreProviders    []string
 	descTag            string
+	defaultDomain      string
+	entryPointDomains  map[string]string
+
+	// domains of each router from the last time its rule parsed successfully
+	lastDomains map[string][]traefik.DomainMatch
 }
 
 func newEngine(cfg *config.Config) *Engine {
+	zoneSplitter := newZoneSplitter(cfg)
 	return &Engine{
-		regexGenerator:     exrex.NewExrexRunner(cfg),
+		ruleCache:          traefik.NewRuleCache(),
+		regexExpander:      newRegexExpander(cfg),
+		zoneSplitter:       zoneSplitter,
+		targetMapper:       newTargetMapper(cfg),
+		rewriter:           newRewriter(cfg),
+		compactor:          newCompactor(cfg, zoneSplitter),
+		describer:          newDescriber(cfg),
+		adoption:           cfg.Reconcile.Adoption,
+		repairDisabled:     cfg.Reconcile.DisabledPolicy == "repair",
+		conflictPolicy:     cfg.Reconcile.ConflictPolicy,
+		protected:          newProtectedDomains(cfg),
+		wildcards:          cfg.Regex.Wildcards,
+		abortOnParseError:  cfg.Traefik.ParseErrorPolicy == "abort",
 		includeEntryPoints: cfg.Traefik.IncludeEntryPoints,
 		ignoreRouters:      cfg.Traefik.IgnoreRouters,
 		includeProviders:   cfg.Traefik.IncludeProviders,
 		ignoreProviders:    cfg.Traefik.IgnoreProviders,
 		descTag:            cfg.Reconcile.DescriptionTag,
+		defaultDomain:      strings.Trim(strings.TrimSpace(cfg.Traefik.DefaultDomain), "."),
+		entryPointDomains:  entryPointDomains(cfg),
+		lastDomains:        make(map[string][]traefik.DomainMatch),
 	}
 }
 
-func (e *Engine) computePlan(routers []traefik.Router, aliases []model.HostAlias) (*model.Plan, error) {
-	desiredAliases, err := e.desiredFromTraefik(routers)
+// computePlan diffs the desired aliases against the current ones. parents maps each target
+// host override FQDN to its UUID, current aliases must already have their Target and Parent set.
+// Desired aliases under a host override missing from parents are left out of the plan, and
+// managed aliases outside the targets are left alone as long as one is missing.
+// Unmanaged aliases and host overrides are checked for conflicts with the aliases to create.
+func (e *Engine) computePlan(snapshot *traefik.Snapshot, aliases []model.HostAlias, hostOverrides []model.HostOverride, parents map[string]string) (*Result, error) {
+	result := &Result{}
+
+	allDesired, err := e.desiredFromTraefik(snapshot.RouterList(), result)
 	if err != nil {
 		return nil, err
 	}
+	var desiredAliases []model.HostAlias
+	for _, d := range allDesired {
+		parent, ok := parents[d.Target]
+		if !ok {
+			continue
+		}
+		d.Parent = parent
+		desiredAliases = append(desiredAliases, d)
+	}
+	unmanaged := e.unmanagedEntries(aliases, hostOverrides)
+	desiredAliases = e.compactor.compact(desiredAliases, unmanaged, result)
 
 	currentAliases, err := e.currentFromOPNsense(aliases)
 	if err != nil {
 		return nil, err
 	}
 
+	targetParents := make(map[string]struct{}, len(parents))
+	for _, parent := range parents {
+		targetParents[parent] = struct{}{}
+	}
+	for _, target := range e.targetMapper.targets() {
+		if _, ok := parents[target]; !ok {
+			result.MissingParents = append(result.MissingParents, target)
+		}
+	}
+	// a missing target may have been renamed or mistyped, the managed aliases found outside the
+	// targets may well belong to it, so they are neither migrated nor deleted until it is back
+	if len(result.MissingParents) > 0 {
+		var underTargets []model.HostAlias
+		for _, c := range currentAliases {
+			if _, ok := targetParents[c.Parent]; ok {
+				underTargets = append(underTargets, c)
+			} else {
+				result.HeldBack++
+			}
+		}
+		currentAliases = underTargets
+	}
+
 	desired := make(map[string]model.HostAlias, len(desiredAliases))
+	desiredByKey := make(map[string][]model.HostAlias)
 	for _, d := range desiredAliases {
-		desired[d.Key()] = d
+		desired[slotKey(d)] = d
+		desiredByKey[d.Key()] = append(desiredByKey[d.Key()], d)
 	}
+	desiredParents := parentsByKey(desiredAliases)
 
+	// of several managed aliases in the same slot, e.g. after a create that timed out but succeeded,
+	// one is kept and the rest are deleted. OPNsense does not list them in creation order, so the
+	// survivor is picked by a rule that holds across cycles: an enabled one first, then the lowest UUID.
 	current := make(map[string]model.HostAlias, len(currentAliases))
+	var duplicates []model.HostAlias
 	for _, c := range currentAliases {
-		current[c.Key()] = c
+		kept, exists := current[slotKey(c)]
+		if !exists {
+			current[slotKey(c)] = c
+			continue
+		}
+		if survives(c, kept) {
+			current[slotKey(c)], c = c, kept
+		}
+		duplicates = append(duplicates, c)
 	}
+	// adopted slots hold an alias that was not managed before this cycle
+	adopted := make(map[string]struct{})
 
 	var operations []model.Operation
+	now := time.Now()
+
+	for _, duplicate := range duplicates {
+		operations = append(operations, model.Operation{
+			Kind:   model.OpDelete,
+			Alias:  duplicate,
+			Reason: "duplicate of " + current[slotKey(duplicate)].UUID,
+		})
+	}
+	result.Duplicates = len(duplicates)
+
+	// take over unmanaged aliases sitting in a desired slot instead of creating a duplicate next to them
+	if e.adoption != "off" {
+		for _, u := range e.unmanagedFromOPNsense(aliases) {
+			key := slotKey(u)
+			d, ok := desired[key]
+			if _, taken := current[key]; !ok || taken {
+				continue
+			}
+			result.Adoptions = append(result.Adoptions, u.Key()+" ("+u.Target+")")
+			if e.adoption == "report" {
+				// neither adopted nor duplicated, the unmanaged alias keeps serving the name
+				current[key] = u
+				adopted[key] = struct{}{}
+				continue
+			}
+			u.Description = e.describer.describe(d, now)
+			reasons := append([]string{"adopted unmanaged alias"}, e.checkEnabled(&u, result)...)
+			current[key] = u
+			adopted[key] = struct{}{}
+			operations = append(operations, model.Operation{
+				Kind:    model.OpUpdate,
+				Alias:   u,
+				Sources: d.Sources,
+				Reason:  strings.Join(reasons, ", "),
+			})
+		}
+	}
 
-	// determine creates
+	// move managed aliases left under former targets into free slots of the same name,
+	// whatever is left over is deleted below
+	moved := make(map[string]struct{})
+	for _, c := range currentAliases {
+		if _, ok := targetParents[c.Parent]; ok {
+			continue
+		}
+		// duplicates are already deleted
+		if current[slotKey(c)].UUID != c.UUID {
+			continue
+		}
+		from := slotKey(c)
+		migration := Migration{Key: c.Key(), From: c.Target}
+		for _, d := range desiredByKey[c.Key()] {
+			to := slotKey(d)
+			if _, taken := current[to]; taken {
+				continue
+			}
+			delete(current, from)
+			if description, ok := e.describer.migrate(c.Description); ok {
+				c.Description = description
+			}
+			c.Target = d.Target
+			c.Parent = d.Parent
+			reasons := append([]string{"moved from " + migration.From}, e.checkEnabled(&c, result)...)
+			current[to] = c
+			moved[to] = struct{}{}
+			migration.To = d.Target
+			operations = append(operations, model.Operation{
+				Kind:    model.OpUpdate,
+				Alias:   c,
+				Sources: d.Sources,
+				Reason:  strings.Join(reasons, ", "),
+			})
+			break
+		}
+		if migration.To == "" && (result.DeletesSuppressed || e.protected.matches(c.Key())) {
+			continue
+		}
+		result.Migrations = append(result.Migrations, migration)
+	}
+
+	// determine creates, the description is only rendered once at creation
 	for key, d := range desired {
 		if _, exists := current[key]; !exists {
+			conflicts := conflictsOf(d, desiredParents[d.Key()], unmanaged)
+			result.Conflicts = append(result.Conflicts, conflicts...)
+			if len(conflicts) > 0 && e.conflictPolicy != "create" {
+				continue
+			}
+			d.Description = e.describer.describe(d, now)
+			op := model.Operation{
+				Kind:    model.OpCreate,
+				Alias:   d,
+				Sources: d.Sources,
+			}
+			if len(conflicts) > 0 {
+				op.Reason = "conflicts with " + conflicts[0].With
+			}
+			if compaction, ok := result.compactionOf(d); ok {
+				// listing every source of a compacted wildcard would drown the log
+				op.Sources = nil
+				op.Reason = fmt.Sprintf("compacts %d names", len(compaction.Names))
+			}
+			operations = append(operations, op)
+		}
+	}
+
+	// correct drift of aliases that are kept: legacy description tags and disabled aliases.
+	// Aliases no longer desired are kept too while deletes are suppressed, or when protected.
+	for key, c := range current {
+		if _, exists := desired[key]; !exists && !result.DeletesSuppressed && !e.protected.matches(c.Key()) {
+			continue
+		}
+		if _, ok := moved[key]; ok {
+			continue
+		}
+		if _, ok := adopted[key]; ok {
+			continue
+		}
+		var reasons []string
+		if description, ok := e.describer.migrate(c.Description); ok {
+			c.Description = description
+			reasons = append(reasons, "migrated legacy description tag")
+		}
+		reasons = append(reasons, e.checkEnabled(&c, result)...)
+		if len(reasons) > 0 {
 			operations = append(operations, model.Operation{
-				Kind:  model.OpCreate,
-				Alias: d,
+				Kind:   model.OpUpdate,
+				Alias:  c,
+				Reason: strings.Join(reasons, ", "),
 			})
 		}
 	}
 
 	// determine deletes
+	if result.DeletesSuppressed {
+		current = nil
+	}
 	for key, c := range current {
 		if _, exists := desired[key]; !exists {
-			operations = append(operations, model.Operation{
+			if e.protected.matches(c.Key()) {
+				result.Protected = append(result.Protected, c.Key()+" ("+c.Target+")")
+				continue
+			}
+			op := model.Operation{
 				Kind:  model.OpDelete,
 				Alias: c,
-			})
+			}
+			if _, ok := targetParents[c.Parent]; !ok {
+				op.Reason = "host override is no longer a target"
+			} else if wildcard, ok := e.compactor.compactedInto(c, result); ok {
+				op.Reason = "compacted into " + wildcard
+			}
+			operations = append(operations, op)
+		}
+	}
+
+	sort.Slice(result.Conflicts, func(i, j int) bool {
+		return result.Conflicts[i].String() < result.Conflicts[j].String()
+	})
+	if len(result.Conflicts) > 0 && e.conflictPolicy == "fail" {
+		conflicts := make([]string, 0, len(result.Conflicts))
+		for _, conflict := range result.Conflicts {
+			conflicts = append(conflicts, conflict.String())
 		}
+		return nil, fmt.Errorf("%d name(s) conflict with unmanaged DNS entries: %s", len(conflicts), strings.Join(conflicts, ", "))
 	}
+	sort.Strings(result.Protected)
+	sort.Strings(result.Disabled)
 
 	sort.Slice(operations, func(i, j int) bool {
-		// delete before create
+		// delete before update before create
 		if operations[i].Kind != operations[j].Kind {
-			return operations[i].Kind == model.OpDelete
+			return opOrder(operations[i].Kind) < opOrder(operations[j].Kind)
 		}
 
-		// alphabetical by fqdn
-		ai := strings.ToLower(operations[i].Alias.Hostname + "." + operations[i].Alias.Domain)
-		aj := strings.ToLower(operations[j].Alias.Hostname + "." + operations[j].Alias.Domain)
+		// alphabetical by fqdn, then target
+		ai := strings.ToLower(operations[i].Alias.Key())
+		aj := strings.ToLower(operations[j].Alias.Key())
 		if ai == aj {
-			return false
+			return operations[i].Alias.Target < operations[j].Alias.Target
 		}
 		return ai < aj
 	})
 
-	return &model.Plan{
+	result.Plan = &model.Plan{
 		Operations: operations,
-	}, nil
+	}
+	return result, nil
+}
+
+func opOrder(kind model.OpKind) int {
+	switch kind {
+	case model.OpDelete:
+		return 0
+	case model.OpUpdate:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// checkEnabled re-enables a disabled alias under the repair policy and returns the reason,
+// otherwise a disabled alias is left alone and reported
+func (e *Engine) checkEnabled(alias *model.HostAlias, result *Result) []string {
+	if alias.Enabled {
+		return nil
+	}
+	if e.repairDisabled {
+		alias.Enabled = true
+		return []string{"re-enabled"}
+	}
+	result.Disabled = append(result.Disabled, alias.Key()+" ("+alias.Target+")")
+	return nil
+}
+
+// slotKey identifies an alias under its parent host override, the same name may exist under several
+func slotKey(alias model.HostAlias) string {
+	return alias.Parent + "|" + alias.Key()
 }
 
 func (e *Engine) currentFromOPNsense(aliases []model.HostAlias) ([]model.HostAlias, error) {
 	var current []model.HostAlias
 
 	for _, alias := range aliases {
-		if alias.Description != e.descTag {
+		if !e.describer.owns(alias.Description) {
 			continue
 		}
-		current = append(current, alias)
+		current = append(current, normalizeAlias(alias))
 	}
 
 	return current, nil
 }
 
-func (e *Engine) desiredFromTraefik(routers []traefik.Router) ([]model.HostAlias, error) {
+// survives reports whether alias a is kept over alias b in the same slot
+func survives(a, b model.HostAlias) bool {
+	if a.Enabled != b.Enabled {
+		return a.Enabled
+	}
+	return a.UUID < b.UUID
+}
+
+// unmanagedFromOPNsense returns the aliases without an ownership marker, normalized like managed ones
+func (e *Engine) unmanagedFromOPNsense(aliases []model.HostAlias) []model.HostAlias {
+	var unmanaged []model.HostAlias
+	for _, alias := range aliases {
+		if e.describer.owns(alias.Description) {
+			continue
+		}
+		unmanaged = append(unmanaged, normalizeAlias(alias))
+	}
+	return unmanaged
+}
+
+// unmanagedEntry is an unmanaged alias or host override a desired name may conflict with
+type unmanagedEntry struct {
+	// parent is empty for host overrides
+	parent string
+	with   string
+}
+
+// unmanagedEntries indexes the unmanaged aliases and host overrides by name
+func (e *Engine) unmanagedEntries(aliases []model.HostAlias, hostOverrides []model.HostOverride) map[string][]unmanagedEntry {
+	entries := make(map[string][]unmanagedEntry)
+	for _, u := range e.unmanagedFromOPNsense(aliases) {
+		entries[u.Key()] = append(entries[u.Key()], unmanagedEntry{parent: u.Parent, with: "unmanaged alias under " + u.Target})
+	}
+	for _, hostOverride := range hostOverrides {
+		if e.describer.owns(hostOverride.Description) {
+			continue
+		}
+		normalized := normalizeAlias(model.HostAlias{Hostname: hostOverride.Hostname, Domain: hostOverride.Domain})
+		key := normalized.Key()
+		entries[key] = append(entries[key], unmanagedEntry{with: "unmanaged host override"})
+	}
+	return entries
+}
+
+// parentsByKey maps each name to the host overrides it is desired under, all host overrides
+// of its target, e.g. both the A and the AAAA record of a dual-stack proxy
+func parentsByKey(aliases []model.HostAlias) map[string]map[string]struct{} {
+	parents := make(map[string]map[string]struct{})
+	for _, alias := range aliases {
+		if parents[alias.Key()] == nil {
+			parents[alias.Key()] = make(map[string]struct{})
+		}
+		parents[alias.Key()][alias.Parent] = struct{}{}
+	}
+	return parents
+}
+
+// conflictsOf returns the unmanaged entries answering for the name of a desired alias with
+// another address. An unmanaged alias under any host override the name is desired under answers the same.
+func conflictsOf(d model.HostAlias, parents map[string]struct{}, unmanaged map[string][]unmanagedEntry) []Conflict {
+	var conflicts []Conflict
+	for _, entry := range unmanaged[d.Key()] {
+		if _, ok := parents[entry.parent]; ok && entry.parent != "" {
+			continue
+		}
+		conflicts = append(conflicts, Conflict{Key: d.Key(), Target: d.Target, With: entry.with})
+	}
+	return conflicts
+}
+
+func (e *Engine) desiredFromTraefik(routers []traefik.Router, result *Result) ([]model.HostAlias, error) {
 	var desired []traefik.Router
 
 	for _, router := range routers {
-		// filter by entrypoints
-		if len(e.includeEntryPoints) > 0 {
-			matched := false
-			for _, ep := range router.EntryPoints {
-				for _, includeEp := range e.includeEntryPoints {
-					if ep == includeEp {
-						matched = true
-						break
-					}
-				}
-				if matched {
-					break
-				}
-			}
-			if !matched {
-				continue
-			}
+		if accepted, _ := e.filterRouter(router); accepted {
+			desired = append(desired, router)
 		}
+	}
+
+	named, lastDomains, err := e.routerNames(desired, result)
+	if err != nil {
+		return nil, err
+	}
+	e.lastDomains = lastDomains
+
+	// evict cached rules and regexes of routers that disappeared
+	e.ruleCache.Sweep()
+	e.regexExpander.sweep()
 
-		// filter by providers
-		if len(e.includeProviders) > 0 {
-			matched := false
-			for _, includeProvider := range e.includeProviders {
-				if router.Provider == includeProvider {
+	// protected names are created as configured, rewrites do not apply to them
+	named = append(named, e.protected.desired()...)
+
+	return e.hostAliases(named, result), nil
+}
+
+// filterRouter applies the configured Traefik filters to a router. The reason describes
+// which filter rejected it, or why it was accepted.
+func (e *Engine) filterRouter(router traefik.Router) (bool, string) {
+	// filter by entrypoints
+	if len(e.includeEntryPoints) > 0 {
+		matched := false
+		for _, ep := range router.EntryPoints {
+			for _, includeEp := range e.includeEntryPoints {
+				if ep == includeEp {
 					matched = true
 					break
 				}
 			}
-			if !matched {
-				continue
+			if matched {
+				break
 			}
 		}
-		if len(e.ignoreProviders) > 0 {
-			ignored := false
-			for _, ignoreProvider := range e.ignoreProviders {
-				if router.Provider == ignoreProvider {
-					ignored = true
-					break
-				}
-			}
-			if ignored {
-				continue
-			}
+		if !matched {
+			return false, "none of its entrypoints are in traefik.include_entrypoints"
 		}
+	}
 
-		// filter by router name
-		if len(e.ignoreRouters) > 0 {
-			ignored := false
-			for _, ignoreRouter := range e.ignoreRouters {
-				if router.Name == ignoreRouter {
-					ignored = true
-					break
-				}
+	// filter by providers
+	if len(e.includeProviders) > 0 {
+		matched := false
+		for _, includeProvider := range e.includeProviders {
+			if router.Provider == includeProvider {
+				matched = true
+				break
 			}
-			if ignored {
-				continue
+		}
+		if !matched {
+			return false, "provider " + router.Provider + " is not in traefik.include_providers"
+		}
+	}
+	if len(e.ignoreProviders) > 0 {
+		for _, ignoreProvider := range e.ignoreProviders {
+			if router.Provider == ignoreProvider {
+				return false, "provider " + router.Provider + " is in traefik.ignore_providers"
 			}
 		}
+	}
 
-		desired = append(desired, router)
+	// filter by router name
+	if len(e.ignoreRouters) > 0 {
+		for _, ignoreRouter := range e.ignoreRouters {
+			if router.Name == ignoreRouter {
+				return false, "router is in traefik.ignore_routers"
+			}
+		}
 	}
 
-	desiredAliases, err := e.routersToHostAliases(desired)
+	return true, "passed all traefik filters"
+}
+
+// routersToHostAliases returns the aliases of the routers without touching the state kept between
+// sync cycles, so explaining a router does not affect the next sync
+func (e *Engine) routersToHostAliases(routers []traefik.Router, result *Result) ([]model.HostAlias, error) {
+	named, _, err := e.routerNames(routers, result)
 	if err != nil {
 		return nil, err
 	}
-
-	return desiredAliases, nil
+	return e.hostAliases(named, result), nil
 }
 
-func (e *Engine) routersToHostAliases(routers []traefik.Router) ([]model.HostAlias, error) {
-	var aliases []model.HostAlias
-
-	var parsedDomains []traefik.DomainMatch
+// routerNames returns the normalized and rewritten names the rules of the routers produce,
+// and the domains parsed from each router
+func (e *Engine) routerNames(routers []traefik.Router, result *Result) ([]sourcedDomain, map[string][]traefik.DomainMatch, error) {
+	var plainDomains []sourcedDomain
+	var unexpanded []string
+	lastDomains := make(map[string][]traefik.DomainMatch, len(routers))
 	for _, router := range routers {
-		domains, err := traefik.ParseDomains(router.Rule)
+		domains, err := e.parseRouter(router, result)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		if domains != nil {
+			lastDomains[router.Name] = domains
+		}
+		var patterns []string
+		for _, domain := range domains {
+			if domain.Regex != "" {
+				patterns = append(patterns, domain.Regex)
+			}
+		}
+		for _, host := range e.regexExpander.unmatched(router.Name, patterns) {
+			result.UnmatchedExpansions = append(result.UnmatchedExpansions, host+" ("+router.Name+")")
 		}
 
-		parsedDomains = append(parsedDomains, domains...)
+		for _, domain := range domains {
+			source := model.Source{
+				Router:   router.Name,
+				Provider: router.Provider,
+				Fragment: domain.Fragment,
+				Regex:    domain.Regex,
+			}
+			if domain.Kind == traefik.DomainLiteral {
+				name := domain.Value
+				if searchDomain := e.searchDomain(router); searchDomain != "" && !strings.Contains(name, ".") {
+					name += "." + searchDomain
+				}
+				plainDomains = append(plainDomains, sourcedDomain{name: name, router: router, source: source})
+			} else if e.wildcardAlias(router, domain) {
+				// a single "*" alias covers every name under the parent domain
+				plainDomains = append(plainDomains, sourcedDomain{name: domain.Value, router: router, source: source})
+			} else {
+				generatedDomains, err := e.regexExpander.expand(router.Name, domain.Regex)
+				if isUnexpandable(err) {
+					unexpanded = append(unexpanded, domain.Regex+" ("+router.Name+")")
+					continue
+				}
+				if err != nil {
+					log.Println("failed to generate domains from regex:", domain.Regex, "error:", err)
+					continue
+				}
+				for _, generated := range generatedDomains {
+					plainDomains = append(plainDomains, sourcedDomain{name: generated, router: router, source: source})
+				}
+			}
+		}
+	}
+
+	if len(unexpanded) > 0 {
+		log.Printf("[Warning] %d HostRegexp pattern(s) cannot be enumerated, map them to hosts in regex.expansions: %s",
+			len(unexpanded), strings.Join(unexpanded, ", "))
 	}
 
-	var plainDomains []string
-	for _, domain := range parsedDomains {
-		if domain.Kind == traefik.DomainLiteral {
-			plainDomains = append(plainDomains, domain.Value)
-		} else if domain.Kind == traefik.DomainRegex {
-			generatedDomains, err := e.regexGenerator.Generate(domain.Value)
-			if err != nil {
-				log.Println("failed to generate domains from regex:", domain.Value, "error:", err)
+	return e.normalizeAndRewrite(plainDomains, result), lastDomains, nil
+}
+
+// hostAliases splits the names into aliases under each of their targets
+func (e *Engine) hostAliases(named []sourcedDomain, result *Result) []model.HostAlias {
+	var aliases []model.HostAlias
+
+	// merge sources of names claimed more than once, keeping first-seen order
+	index := make(map[string]int, len(named))
+	for _, plain := range named {
+		name := plain.name
+		hostname, domain, inZone, ok := e.zoneSplitter.split(name)
+		if !inZone && e.zoneSplitter.policy != "default" {
+			result.OutsideZones = append(result.OutsideZones, name+" ("+plain.source.String()+")")
+		}
+		if !ok {
+			if inZone {
+				log.Printf("skipping zone apex: %s (%s)", name, plain.source)
+			} else if e.zoneSplitter.policy != "skip" {
+				log.Printf("skipping invalid domain: %s (%s)", name, plain.source)
+			}
+			continue
+		}
+		// the same alias set is created under every host override of the target
+		for _, target := range e.targetMapper.target(plain.router, name) {
+			alias := model.HostAlias{
+				Hostname:    hostname,
+				Domain:      domain,
+				Description: e.descTag,
+				Target:      target,
+				Enabled:     true,
+			}
+			key := alias.Target + "|" + alias.Key()
+			if i, ok := index[key]; ok {
+				aliases[i].Sources = append(aliases[i].Sources, plain.source)
 				continue
 			}
-			plainDomains = append(plainDomains, generatedDomains...)
+			alias.Sources = []model.Source{plain.source}
+			index[key] = len(aliases)
+			aliases = append(aliases, alias)
 		}
 	}
 
-	for _, domain := range plainDomains {
-		hostname, domain, found := strings.Cut(domain, ".")
-		if !found || hostname == "" || domain == "" {
-			log.Println("skipping invalid domain:", domain)
+	result.Collisions = findCollisions(aliases)
+
+	return aliases
+}
+
+// wildcardAlias reports whether the domain becomes a single "*" alias, unless regex.expansions lists its hosts
+func (e *Engine) wildcardAlias(router traefik.Router, domain traefik.DomainMatch) bool {
+	return domain.Kind == traefik.DomainWildcard && e.wildcards && !e.regexExpander.mapped(router.Name, domain.Regex)
+}
+
+// normalizeAndRewrite normalizes every name and applies the rewrite rules to it. Rewritten
+// names are normalized again, since rules may produce anything.
+func (e *Engine) normalizeAndRewrite(plainDomains []sourcedDomain, result *Result) []sourcedDomain {
+	var out []sourcedDomain
+	for _, plain := range plainDomains {
+		name, err := dnsname.Normalize(plain.name)
+		if err != nil {
+			result.InvalidNames = append(result.InvalidNames, InvalidName{Name: plain.name, Source: plain.source, Err: err})
 			continue
 		}
-		aliases = append(aliases, model.HostAlias{
-			Hostname:    hostname,
-			Domain:      domain,
-			Description: e.descTag,
-		})
+
+		for _, rewritten := range e.rewriter.apply(name) {
+			if rewritten != name {
+				normalized, err := dnsname.Normalize(rewritten)
+				if err != nil {
+					result.InvalidNames = append(result.InvalidNames, InvalidName{Name: rewritten, Source: plain.source, Err: err})
+					continue
+				}
+				rewritten = normalized
+			}
+			out = append(out, sourcedDomain{name: rewritten, router: plain.router, source: plain.source})
+		}
+	}
+	return out
+}
+
+// normalizeAlias brings an alias from OPNsense into the same form as desired aliases, so keys
+// compare equal regardless of case, trailing dots or Unicode vs punycode. Names that fail to
+// normalize are only lower-cased, they will not match anything desired and get deleted.
+func normalizeAlias(alias model.HostAlias) model.HostAlias {
+	hostname, err := dnsname.NormalizeLabels(alias.Hostname)
+	if err != nil {
+		hostname = strings.ToLower(alias.Hostname)
+	}
+	domain, err := dnsname.Normalize(alias.Domain)
+	if err != nil {
+		domain = strings.ToLower(alias.Domain)
+	}
+	alias.Hostname = hostname
+	alias.Domain = domain
+	return alias
+}
+
+type sourcedDomain struct {
+	name   string
+	router traefik.Router
+	source model.Source
+}
+
+// findCollisions reports names claimed by more than one router, whichever targets they map to
+func findCollisions(aliases []model.HostAlias) []Collision {
+	var order []string
+	routersByKey := make(map[string][]string)
+	for _, alias := range aliases {
+		key := alias.Key()
+		if _, ok := routersByKey[key]; !ok {
+			order = append(order, key)
+			routersByKey[key] = nil
+		}
+		for _, source := range alias.Sources {
+			if source.Router != "" && !slices.Contains(routersByKey[key], source.Router) {
+				routersByKey[key] = append(routersByKey[key], source.Router)
+			}
+		}
+	}
+
+	var collisions []Collision
+	for _, key := range order {
+		if routers := routersByKey[key]; len(routers) > 1 {
+			collisions = append(collisions, Collision{Key: key, Routers: routers})
+		}
+	}
+	return collisions
+}
+
+// searchDomain returns the domain appended to single-label Host rules of the router:
+// the domain of its first entrypoint that has one configured, otherwise the default domain
+func (e *Engine) searchDomain(router traefik.Router) string {
+	for _, ep := range router.EntryPoints {
+		if domain, ok := e.entryPointDomains[ep]; ok {
+			return domain
+		}
+	}
+	return e.defaultDomain
+}
+
+func entryPointDomains(cfg *config.Config) map[string]string {
+	domains := make(map[string]string, len(cfg.Traefik.EntryPointDomains))
+	for _, epDomain := range cfg.Traefik.EntryPointDomains {
+		domains[epDomain.EntryPoint] = strings.Trim(strings.TrimSpace(epDomain.Domain), ".")
+	}
+	return domains
+}
+
+// parseRouter parses the rule of a router. Under the skip policy a broken rule falls back to the
+// domains the router had the last time its rule parsed, so its existing aliases are kept. If those
+// are unknown (e.g. right after startup), deletes are suppressed for the whole cycle instead.
+func (e *Engine) parseRouter(router traefik.Router, result *Result) ([]traefik.DomainMatch, error) {
+	domains, err := e.ruleCache.ParseRouterDomains(router)
+	if err == nil {
+		return domains, nil
 	}
 
-	return aliases, nil
+	var parseErr *traefik.ParseError
+	if !errors.As(err, &parseErr) {
+		return nil, err
+	}
+	result.ParseErrors = append(result.ParseErrors, parseErr)
+	if e.abortOnParseError {
+		return nil, err
+	}
+
+	last, ok := e.lastDomains[router.Name]
+	if !ok {
+		result.DeletesSuppressed = true
+	}
+	return last, nil
 }
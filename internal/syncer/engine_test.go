@@ -0,0 +1,335 @@
+package syncer
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/go-viper/mapstructure/v2"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/config"
+	"github.com/0x464e/traefik-opnsense-sync/internal/model"
+	"github.com/0x464e/traefik-opnsense-sync/internal/traefik"
+)
+
+const testTag = "Managed by traefik-opnsense-sync"
+
+// newTestEngine builds an engine from the defaults of the config loader, overridden by settings
+func newTestEngine(t *testing.T, settings map[string]any) *Engine {
+	t.Helper()
+
+	var cfg config.Config
+	defaults := map[string]any{
+		"opnsense": map[string]any{
+			"host_override": []string{"proxy.example.com"},
+			"backend":       "unbound",
+			"mode":          "alias",
+		},
+		"regex": map[string]any{"max_generated": 5},
+		"reconcile": map[string]any{
+			"description_tag":     testTag,
+			"outside_zone_policy": "default",
+			"description":         map[string]any{"marker": "prefix"},
+			"adoption":            "off",
+			"disabled_policy":     "respect",
+			"conflict_policy":     "create",
+		},
+	}
+	for _, m := range []map[string]any{defaults, settings} {
+		if err := mapstructure.Decode(m, &cfg); err != nil {
+			t.Fatalf("decode config: %v", err)
+		}
+	}
+	return newEngine(&cfg)
+}
+
+func testSnapshot(rules map[string]string) *traefik.Snapshot {
+	snapshot := &traefik.Snapshot{Routers: make(map[string]traefik.Router, len(rules))}
+	for name, rule := range rules {
+		snapshot.Routers[name] = traefik.Router{Name: name, Provider: "docker", Rule: rule}
+	}
+	return snapshot
+}
+
+func managedAlias(uuid, hostname, domain, target, parent string) model.HostAlias {
+	return model.HostAlias{
+		UUID:        uuid,
+		Hostname:    hostname,
+		Domain:      domain,
+		Description: testTag,
+		Target:      target,
+		Parent:      parent,
+		Enabled:     true,
+	}
+}
+
+func TestComputePlanMovesAliasesOfFormerTargets(t *testing.T) {
+	e := newTestEngine(t, nil)
+	snapshot := testSnapshot(map[string]string{"app@docker": "Host(`app.example.com`)"})
+	aliases := []model.HostAlias{managedAlias("a1", "app", "example.com", "old.example.com", "old-uuid")}
+	parents := map[string]string{"proxy.example.com": "proxy-uuid"}
+
+	result, err := e.computePlan(snapshot, aliases, nil, parents)
+	if err != nil {
+		t.Fatalf("computePlan: %v", err)
+	}
+	ops := result.Plan.Operations
+	if len(ops) != 1 || ops[0].Kind != model.OpUpdate || ops[0].Alias.Parent != "proxy-uuid" {
+		t.Fatalf("expected a single move to proxy-uuid, got %+v", ops)
+	}
+}
+
+func TestComputePlanKeepsAliasesOfFormerTargetsWhileTargetMissing(t *testing.T) {
+	e := newTestEngine(t, map[string]any{
+		"opnsense": map[string]any{"host_override": []string{"proxy.example.com", "proxy6.example.com"}},
+	})
+	snapshot := testSnapshot(map[string]string{"app@docker": "Host(`app.example.com`)"})
+	aliases := []model.HostAlias{
+		managedAlias("a1", "app", "example.com", "old.example.com", "old-uuid"),
+		managedAlias("a2", "gone", "example.com", "old.example.com", "old-uuid"),
+	}
+
+	for name, parents := range map[string]map[string]string{
+		"no target found":  {},
+		"one target found": {"proxy.example.com": "proxy-uuid"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			result, err := e.computePlan(snapshot, aliases, nil, parents)
+			if err != nil {
+				t.Fatalf("computePlan: %v", err)
+			}
+			for _, op := range result.Plan.Operations {
+				if op.Alias.Parent == "old-uuid" {
+					t.Errorf("unexpected %s of %s under a former target", op.Kind, op.Alias.Key())
+				}
+			}
+			if len(result.Migrations) != 0 {
+				t.Errorf("expected no migrations, got %+v", result.Migrations)
+			}
+			if result.HeldBack != 2 {
+				t.Errorf("expected 2 aliases held back, got %d", result.HeldBack)
+			}
+			if len(result.MissingParents) == 0 {
+				t.Error("expected the missing target to be reported")
+			}
+		})
+	}
+}
+
+func TestDesiredPrefersExpansionsOverWildcards(t *testing.T) {
+	pattern := `^[a-z0-9-]+\.apps\.example\.com$`
+	e := newTestEngine(t, map[string]any{
+		"regex": map[string]any{
+			"wildcards": true,
+			"expansions": []map[string]any{
+				{"pattern": pattern, "hosts": []string{"grafana.apps.example.com"}},
+			},
+		},
+	})
+	routers := testSnapshot(map[string]string{
+		"apps@docker": "HostRegexp(`" + pattern + "`)",
+		"dev@docker":  "HostRegexp(`^.+\\.dev\\.example\\.com$`)",
+	}).RouterList()
+
+	aliases, err := e.desiredFromTraefik(routers, &Result{})
+	if err != nil {
+		t.Fatalf("desiredFromTraefik: %v", err)
+	}
+	var keys []string
+	for _, alias := range aliases {
+		keys = append(keys, alias.Key())
+	}
+	want := []string{"grafana.apps.example.com", "*.dev.example.com"}
+	if !slices.Equal(keys, want) {
+		t.Fatalf("expected %v, got %v", want, keys)
+	}
+}
+
+func TestComputePlanConflicts(t *testing.T) {
+	snapshot := testSnapshot(map[string]string{"app@docker": "Host(`app.example.com`)"})
+	parents := map[string]string{"proxy.example.com": "proxy-uuid", "proxy6.example.com": "proxy6-uuid", "other.example.com": "other-uuid"}
+	dualStack := map[string]any{"host_override": []string{"proxy.example.com", "proxy6.example.com"}}
+	unmanagedUnder := func(target, parent string) model.HostAlias {
+		return model.HostAlias{UUID: "u1", Hostname: "app", Domain: "example.com", Target: target, Parent: parent, Enabled: true}
+	}
+
+	tests := []struct {
+		name          string
+		policy        string
+		aliases       []model.HostAlias
+		hostOverrides []model.HostOverride
+		// per record of the dual-stack target
+		creates   int
+		conflicts int
+	}{
+		{"hand-made alias under the other record of a dual-stack target", "skip", []model.HostAlias{unmanagedUnder("proxy6.example.com", "proxy6-uuid")}, nil, 2, 0},
+		{"hand-made alias under another target", "skip", []model.HostAlias{unmanagedUnder("other.example.com", "other-uuid")}, nil, 0, 2},
+		{"hand-made alias under another target created anyway", "create", []model.HostAlias{unmanagedUnder("other.example.com", "other-uuid")}, nil, 2, 2},
+		{"unmanaged host override", "skip", nil, []model.HostOverride{{UUID: "h1", Hostname: "app", Domain: "example.com"}}, 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine(t, map[string]any{
+				"opnsense":  dualStack,
+				"reconcile": map[string]any{"conflict_policy": tt.policy},
+			})
+			result, err := e.computePlan(snapshot, tt.aliases, tt.hostOverrides, parents)
+			if err != nil {
+				t.Fatalf("computePlan: %v", err)
+			}
+			var creates int
+			for _, op := range result.Plan.Operations {
+				if op.Kind == model.OpCreate {
+					creates++
+				}
+			}
+			if creates != tt.creates {
+				t.Errorf("expected %d creates, got %+v", tt.creates, result.Plan.Operations)
+			}
+			if len(result.Conflicts) != tt.conflicts {
+				t.Errorf("expected %d conflicts, got %+v", tt.conflicts, result.Conflicts)
+			}
+		})
+	}
+}
+
+func TestComputePlanFailsOnConflicts(t *testing.T) {
+	e := newTestEngine(t, map[string]any{"reconcile": map[string]any{"conflict_policy": "fail"}})
+	snapshot := testSnapshot(map[string]string{"app@docker": "Host(`app.example.com`)"})
+	hostOverrides := []model.HostOverride{{UUID: "h1", Hostname: "app", Domain: "example.com"}}
+
+	if _, err := e.computePlan(snapshot, nil, hostOverrides, map[string]string{"proxy.example.com": "proxy-uuid"}); err == nil {
+		t.Fatal("expected the conflict to fail the plan")
+	}
+}
+
+func TestComputePlanCleansUpDuplicates(t *testing.T) {
+	e := newTestEngine(t, nil)
+	snapshot := testSnapshot(map[string]string{"app@docker": "Host(`app.example.com`)"})
+	parents := map[string]string{"proxy.example.com": "proxy-uuid"}
+	disabled := managedAlias("a1", "app", "example.com", "proxy.example.com", "proxy-uuid")
+	disabled.Enabled = false
+	aliases := []model.HostAlias{
+		managedAlias("a3", "app", "example.com", "proxy.example.com", "proxy-uuid"),
+		disabled,
+		managedAlias("a2", "app", "example.com", "proxy.example.com", "proxy-uuid"),
+	}
+
+	// the survivor does not depend on the order OPNsense lists the aliases in
+	for range 2 {
+		result, err := e.computePlan(snapshot, aliases, nil, parents)
+		if err != nil {
+			t.Fatalf("computePlan: %v", err)
+		}
+		var deleted []string
+		for _, op := range result.Plan.Operations {
+			if op.Kind != model.OpDelete || op.Reason != "duplicate of a2" {
+				t.Fatalf("expected only deletes of duplicates of a2, got %+v", op)
+			}
+			deleted = append(deleted, op.Alias.UUID)
+		}
+		slices.Sort(deleted)
+		if !slices.Equal(deleted, []string{"a1", "a3"}) || result.Duplicates != 2 {
+			t.Fatalf("expected a1 and a3 deleted, got %v", deleted)
+		}
+		slices.Reverse(aliases)
+	}
+}
+
+func TestComputePlanMigratesLegacyTagsOfKeptAliases(t *testing.T) {
+	parents := map[string]string{"proxy.example.com": "proxy-uuid"}
+	legacyAlias := func(uuid, hostname string) model.HostAlias {
+		alias := managedAlias(uuid, hostname, "example.com", "proxy.example.com", "proxy-uuid")
+		alias.Description = "Old tag"
+		return alias
+	}
+	aliases := []model.HostAlias{legacyAlias("a1", "app"), legacyAlias("a2", "sso"), legacyAlias("a3", "gone")}
+
+	tests := []struct {
+		name     string
+		rule     string
+		migrated []string
+	}{
+		{"desired and protected", "Host(`app.example.com`)", []string{"a1", "a2"}},
+		// the domains of the router are unknown, so every alias is kept
+		{"deletes suppressed", "Host(`app.example.com`", []string{"a1", "a2", "a3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEngine(t, map[string]any{
+				"reconcile": map[string]any{
+					"legacy_description_tags": []string{"Old tag"},
+					"protected_domains":       []string{"sso.example.com"},
+				},
+			})
+			snapshot := testSnapshot(map[string]string{"app@docker": tt.rule})
+			result, err := e.computePlan(snapshot, aliases, nil, parents)
+			if err != nil {
+				t.Fatalf("computePlan: %v", err)
+			}
+			var migrated []string
+			for _, op := range result.Plan.Operations {
+				if op.Kind == model.OpUpdate && op.Alias.Description == testTag {
+					migrated = append(migrated, op.Alias.UUID)
+				}
+			}
+			slices.Sort(migrated)
+			if !slices.Equal(migrated, tt.migrated) {
+				t.Fatalf("expected %v migrated, got %+v", tt.migrated, result.Plan.Operations)
+			}
+		})
+	}
+}
+
+func TestComputePlanAdoption(t *testing.T) {
+	snapshot := testSnapshot(map[string]string{"app@docker": "Host(`app.example.com`) || Host(`wiki.example.com`)"})
+	parents := map[string]string{"proxy.example.com": "proxy-uuid"}
+	unmanaged := func(uuid, hostname string) model.HostAlias {
+		return model.HostAlias{UUID: uuid, Hostname: hostname, Domain: "example.com", Description: "my note", Target: "proxy.example.com", Parent: "proxy-uuid", Enabled: true}
+	}
+	aliases := []model.HostAlias{
+		unmanaged("u1", "app"),
+		// not desired, never adopted
+		unmanaged("u2", "manual"),
+		// the slot is already managed
+		unmanaged("u3", "wiki"),
+		managedAlias("a1", "wiki", "example.com", "proxy.example.com", "proxy-uuid"),
+	}
+
+	tests := []struct {
+		policy    string
+		ops       []string
+		adoptions []string
+	}{
+		// a managed alias is created next to the unmanaged one
+		{"off", []string{"CREATE app.example.com"}, nil},
+		{"report", nil, []string{"app.example.com (proxy.example.com)"}},
+		{"on", []string{"UPDATE app.example.com u1"}, []string{"app.example.com (proxy.example.com)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			e := newTestEngine(t, map[string]any{"reconcile": map[string]any{"adoption": tt.policy}})
+			result, err := e.computePlan(snapshot, aliases, nil, parents)
+			if err != nil {
+				t.Fatalf("computePlan: %v", err)
+			}
+			var ops []string
+			for _, op := range result.Plan.Operations {
+				switch op.Kind {
+				case model.OpCreate:
+					ops = append(ops, "CREATE "+op.Alias.Key())
+				default:
+					if op.Alias.Description != testTag || op.Reason != "adopted unmanaged alias" {
+						t.Errorf("unexpected %s of %s: %q (%s)", op.Kind, op.Alias.Key(), op.Alias.Description, op.Reason)
+					}
+					ops = append(ops, op.Kind.String()+" "+op.Alias.Key()+" "+op.Alias.UUID)
+				}
+			}
+			if !slices.Equal(ops, tt.ops) {
+				t.Errorf("expected %v, got %v", tt.ops, ops)
+			}
+			if !slices.Equal(result.Adoptions, tt.adoptions) {
+				t.Errorf("expected adoptions %v, got %v", tt.adoptions, result.Adoptions)
+			}
+		})
+	}
+}
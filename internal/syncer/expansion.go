@@ -0,0 +1,139 @@
+package syncer
+
+import (
+	"errors"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/config"
+	"github.com/0x464e/traefik-opnsense-sync/internal/exrex"
+)
+
+// regexExpander turns HostRegexp patterns into hostnames. Explicit expansions from the config
+// take precedence over enumerating the pattern, since not every regex has a sensible finite language.
+type regexExpander struct {
+	generator *exrex.Exrex
+	byPattern map[string][]string
+	byRouter  map[string][]string
+
+	// compiled router patterns the expansion hosts of a router are matched against, until evicted by sweep
+	compiled map[string]*compiledPattern
+}
+
+type compiledPattern struct {
+	re   *regexp.Regexp
+	used bool
+}
+
+func newRegexExpander(cfg *config.Config) *regexExpander {
+	x := &regexExpander{
+		generator: exrex.NewExrex(cfg),
+		byPattern: make(map[string][]string),
+		byRouter:  make(map[string][]string),
+		compiled:  make(map[string]*compiledPattern),
+	}
+	for _, expansion := range cfg.Regex.Expansions {
+		hosts := make([]string, 0, len(expansion.Hosts))
+		for _, host := range expansion.Hosts {
+			hosts = append(hosts, strings.ToLower(strings.TrimSpace(host)))
+		}
+		// rule values are lowercased by the parser, so the lookup keys are too
+		if expansion.Pattern != "" {
+			x.byPattern[strings.ToLower(expansion.Pattern)] = append(x.byPattern[strings.ToLower(expansion.Pattern)], hosts...)
+		} else {
+			x.byRouter[expansion.Router] = append(x.byRouter[expansion.Router], hosts...)
+		}
+	}
+	return x
+}
+
+func (x *regexExpander) expand(router, pattern string) ([]string, error) {
+	if hosts, ok := x.byPattern[pattern]; ok {
+		return hosts, nil
+	}
+
+	if _, ok := x.byRouter[router]; ok {
+		if matched := x.routerHosts(router, pattern); len(matched) > 0 {
+			return matched, nil
+		}
+		log.Printf("[Warning] none of the configured expansion hosts for router %s match regex %q", router, pattern)
+	}
+
+	return x.generator.Generate(pattern)
+}
+
+// mapped reports whether an explicit expansion applies to the pattern, which then takes
+// precedence over a wildcard alias as well
+func (x *regexExpander) mapped(router, pattern string) bool {
+	if _, ok := x.byPattern[pattern]; ok {
+		return true
+	}
+	return len(x.routerHosts(router, pattern)) > 0
+}
+
+// routerHosts returns the expansion hosts of the router matching the pattern. A router may
+// have several regexes, each one only gets the hosts it matches.
+func (x *regexExpander) routerHosts(router, pattern string) []string {
+	hosts, ok := x.byRouter[router]
+	if !ok {
+		return nil
+	}
+	re := x.compile(pattern)
+	if re == nil {
+		return nil
+	}
+	var matched []string
+	for _, host := range hosts {
+		if re.MatchString(host) {
+			matched = append(matched, host)
+		}
+	}
+	return matched
+}
+
+// unmatched returns the expansion hosts of the router matching none of its patterns, those
+// would silently never be synced
+func (x *regexExpander) unmatched(router string, patterns []string) []string {
+	var unmatched []string
+	for _, host := range x.byRouter[router] {
+		if !slices.ContainsFunc(patterns, func(pattern string) bool {
+			re := x.compile(pattern)
+			return re != nil && re.MatchString(host)
+		}) {
+			unmatched = append(unmatched, host)
+		}
+	}
+	return unmatched
+}
+
+// compile returns the compiled pattern, or nil if it does not compile
+func (x *regexExpander) compile(pattern string) *regexp.Regexp {
+	entry, ok := x.compiled[pattern]
+	if !ok {
+		// an invalid pattern is cached as nil too
+		re, _ := regexp.Compile("(?i)" + pattern)
+		entry = &compiledPattern{re: re}
+		x.compiled[pattern] = entry
+	}
+	entry.used = true
+	return entry.re
+}
+
+// sweep evicts the enumerated and compiled patterns not used since the previous sweep
+func (x *regexExpander) sweep() {
+	x.generator.Sweep()
+	for pattern, entry := range x.compiled {
+		if !entry.used {
+			delete(x.compiled, pattern)
+			continue
+		}
+		entry.used = false
+	}
+}
+
+// isUnexpandable reports whether err means the pattern needs an explicit expansion
+func isUnexpandable(err error) bool {
+	return errors.Is(err, exrex.ErrInfinite) || errors.Is(err, exrex.ErrTooLarge)
+}
@@ -0,0 +1,52 @@
+package syncer
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDesiredReportsUnmatchedExpansionHosts(t *testing.T) {
+	e := newTestEngine(t, map[string]any{
+		"regex": map[string]any{
+			"expansions": []map[string]any{
+				{"router": "apps@docker", "hosts": []string{"grafana.apps.example.com", "wiki.docs.example.com", "typo.apps.example.org"}},
+			},
+		},
+	})
+	routers := testSnapshot(map[string]string{
+		"apps@docker": "HostRegexp(`^[a-z]+\\.apps\\.example\\.com$`) || HostRegexp(`^[a-z]+\\.docs\\.example\\.com$`)",
+	}).RouterList()
+
+	result := &Result{}
+	aliases, err := e.desiredFromTraefik(routers, result)
+	if err != nil {
+		t.Fatalf("desiredFromTraefik: %v", err)
+	}
+	var keys []string
+	for _, alias := range aliases {
+		keys = append(keys, alias.Key())
+	}
+	if want := []string{"grafana.apps.example.com", "wiki.docs.example.com"}; !slices.Equal(keys, want) {
+		t.Fatalf("expected %v, got %v", want, keys)
+	}
+	if want := []string{"typo.apps.example.org (apps@docker)"}; !slices.Equal(result.UnmatchedExpansions, want) {
+		t.Fatalf("expected %v reported, got %v", want, result.UnmatchedExpansions)
+	}
+}
+
+func TestRegexExpanderSweepEvictsUnusedPatterns(t *testing.T) {
+	e := newTestEngine(t, nil)
+	x := e.regexExpander
+	x.compile(`^a\.example\.com$`)
+	x.compile(`^b\.example\.com$`)
+	x.sweep()
+
+	x.compile(`^a\.example\.com$`)
+	x.sweep()
+	if _, ok := x.compiled[`^b\.example\.com$`]; ok {
+		t.Fatal("unused pattern is still compiled")
+	}
+	if _, ok := x.compiled[`^a\.example\.com$`]; !ok {
+		t.Fatal("used pattern was evicted")
+	}
+}
@@ -0,0 +1,98 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/model"
+	"github.com/0x464e/traefik-opnsense-sync/internal/traefik"
+)
+
+// Explanation describes what a single rule or router would produce
+type Explanation struct {
+	// Router is nil when explaining a raw rule
+	Router *traefik.Router
+	Rule   *traefik.RuleExplanation
+
+	// Accepted and FilterReason describe the Traefik filters, which only apply to routers
+	Accepted     bool
+	FilterReason string
+
+	Expansions []RegexExpansion
+	Aliases    []model.HostAlias
+	// Result holds the per-name diagnostics, such as invalid names
+	Result *Result
+}
+
+type RegexExpansion struct {
+	Regex string
+	Hosts []string
+	Err   error
+}
+
+// ExplainRule explains a raw rule string, Traefik filters are not applied
+func (r *Runner) ExplainRule(rule string) (*Explanation, error) {
+	return r.engine.explain(traefik.Router{Rule: rule}, false)
+}
+
+// ExplainRouter explains a router from the live Traefik API
+func (r *Runner) ExplainRouter(ctx context.Context, name string) (*Explanation, error) {
+	snapshot, err := r.traefik.GetSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	router, ok := snapshot.Router(name)
+	if !ok {
+		return nil, fmt.Errorf("router %q not found from Traefik", name)
+	}
+
+	explanation, err := r.engine.explain(router, true)
+	if err != nil {
+		return nil, err
+	}
+	explanation.Router = &router
+	return explanation, nil
+}
+
+func (e *Engine) explain(router traefik.Router, applyFilters bool) (*Explanation, error) {
+	rule, err := traefik.ExplainRule(router.Rule)
+	if err != nil {
+		var parseErr *traefik.ParseError
+		if errors.As(err, &parseErr) {
+			parseErr.Router = router.Name
+		}
+		return nil, err
+	}
+
+	explanation := &Explanation{
+		Rule:     rule,
+		Accepted: true,
+		Result:   &Result{},
+	}
+	if applyFilters {
+		explanation.Accepted, explanation.FilterReason = e.filterRouter(router)
+	}
+
+	for _, domain := range rule.Domains {
+		if domain.Kind == traefik.DomainLiteral || e.wildcardAlias(router, domain) {
+			continue
+		}
+		hosts, err := e.regexExpander.expand(router.Name, domain.Regex)
+		explanation.Expansions = append(explanation.Expansions, RegexExpansion{
+			Regex: domain.Regex,
+			Hosts: hosts,
+			Err:   err,
+		})
+	}
+
+	if !explanation.Accepted {
+		return explanation, nil
+	}
+	aliases, err := e.routersToHostAliases([]traefik.Router{router}, explanation.Result)
+	if err != nil {
+		return nil, err
+	}
+	explanation.Aliases = aliases
+	return explanation, nil
+}
@@ -0,0 +1,59 @@
+package syncer
+
+import (
+	"testing"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/traefik"
+)
+
+func TestExplainLeavesOutProtectedDomains(t *testing.T) {
+	e := newTestEngine(t, map[string]any{
+		"reconcile": map[string]any{
+			"protected_domains":        []string{"sso.example.com"},
+			"create_protected_domains": true,
+		},
+	})
+
+	explanation, err := e.explain(traefik.Router{Rule: "Host(`app.example.com`)"}, false)
+	if err != nil {
+		t.Fatalf("explain: %v", err)
+	}
+	if len(explanation.Aliases) != 1 || explanation.Aliases[0].Key() != "app.example.com" {
+		t.Fatalf("expected only app.example.com, got %+v", explanation.Aliases)
+	}
+
+	// the sync itself still creates them
+	aliases, err := e.desiredFromTraefik(nil, &Result{})
+	if err != nil {
+		t.Fatalf("desiredFromTraefik: %v", err)
+	}
+	if len(aliases) != 1 || aliases[0].Key() != "sso.example.com" {
+		t.Fatalf("expected sso.example.com to be desired, got %+v", aliases)
+	}
+}
+
+func TestExplainLeavesSyncStateAlone(t *testing.T) {
+	e := newTestEngine(t, nil)
+	routers := testSnapshot(map[string]string{"app@docker": "Host(`app.example.com`)"}).RouterList()
+	if _, err := e.desiredFromTraefik(routers, &Result{}); err != nil {
+		t.Fatalf("desiredFromTraefik: %v", err)
+	}
+
+	if _, err := e.explain(traefik.Router{Name: "other@docker", Rule: "Host(`other.example.com`)"}, false); err != nil {
+		t.Fatalf("explain: %v", err)
+	}
+	if _, ok := e.lastDomains["app@docker"]; !ok || len(e.lastDomains) != 1 {
+		t.Fatalf("expected the domains of the last sync to be kept, got %v", e.lastDomains)
+	}
+
+	// a router of the last sync failing to parse still falls back to its last domains
+	routers[0].Rule = "Host(`app.example.com`"
+	result := &Result{}
+	aliases, err := e.desiredFromTraefik(routers, result)
+	if err != nil {
+		t.Fatalf("desiredFromTraefik: %v", err)
+	}
+	if result.DeletesSuppressed || len(aliases) != 1 || aliases[0].Key() != "app.example.com" {
+		t.Fatalf("expected app.example.com from the last domains, got %+v", aliases)
+	}
+}
@@ -0,0 +1,100 @@
+package syncer
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/config"
+	"github.com/0x464e/traefik-opnsense-sync/internal/traefik"
+)
+
+// targetMapper picks the host overrides each desired name is attached to. Rules are tried in
+// order and the first match wins, names matching no rule go to opnsense.host_override.
+// A target may consist of several host overrides, e.g. an A and an AAAA record for the same proxy.
+type targetMapper struct {
+	rules    []targetRule
+	fallback []string
+}
+
+type targetRule struct {
+	hostOverrides  []string
+	entryPoints    []string
+	providers      []string
+	routers        []string
+	domainSuffixes []string
+}
+
+func newTargetMapper(cfg *config.Config) *targetMapper {
+	rules := make([]targetRule, 0, len(cfg.OPNsense.Mappings))
+	for _, mapping := range cfg.OPNsense.Mappings {
+		suffixes := make([]string, 0, len(mapping.DomainSuffixes))
+		for _, suffix := range mapping.DomainSuffixes {
+			suffixes = append(suffixes, strings.Trim(strings.ToLower(strings.TrimSpace(suffix)), "."))
+		}
+		rules = append(rules, targetRule{
+			hostOverrides:  trimAll(mapping.HostOverride),
+			entryPoints:    mapping.EntryPoints,
+			providers:      mapping.Providers,
+			routers:        mapping.Routers,
+			domainSuffixes: suffixes,
+		})
+	}
+	return &targetMapper{
+		rules:    rules,
+		fallback: trimAll(cfg.OPNsense.HostOverride),
+	}
+}
+
+// target returns the host overrides for name, which was produced by router
+func (m *targetMapper) target(router traefik.Router, name string) []string {
+	for _, rule := range m.rules {
+		if ruleMatches(rule, router, name) {
+			return rule.hostOverrides
+		}
+	}
+	return m.fallback
+}
+
+// targets returns every configured host override, those of the fallback first
+func (m *targetMapper) targets() []string {
+	targets := slices.Clone(m.fallback)
+	for _, rule := range m.rules {
+		for _, hostOverride := range rule.hostOverrides {
+			if !slices.Contains(targets, hostOverride) {
+				targets = append(targets, hostOverride)
+			}
+		}
+	}
+	return targets
+}
+
+func trimAll(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// a rule matches when every criterion it sets matches, any value of a criterion may match
+func ruleMatches(rule targetRule, router traefik.Router, name string) bool {
+	if len(rule.entryPoints) > 0 && !slices.ContainsFunc(router.EntryPoints, func(ep string) bool {
+		return slices.Contains(rule.entryPoints, ep)
+	}) {
+		return false
+	}
+	if len(rule.providers) > 0 && !slices.Contains(rule.providers, router.Provider) {
+		return false
+	}
+	if len(rule.routers) > 0 && !slices.Contains(rule.routers, router.Name) {
+		return false
+	}
+	if len(rule.domainSuffixes) > 0 && !slices.ContainsFunc(rule.domainSuffixes, func(suffix string) bool {
+		return name == suffix || strings.HasSuffix(name, "."+suffix)
+	}) {
+		return false
+	}
+	return true
+}
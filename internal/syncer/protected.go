@@ -0,0 +1,64 @@
+package syncer
+
+import (
+	"path"
+	"strings"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/config"
+	"github.com/0x464e/traefik-opnsense-sync/internal/dnsname"
+	"github.com/0x464e/traefik-opnsense-sync/internal/model"
+)
+
+// protectedDomains are names whose aliases are never deleted, given as exact names or globs
+type protectedDomains struct {
+	patterns []string
+	// create makes the exact names desired even when no router exposes them
+	create bool
+}
+
+func newProtectedDomains(cfg *config.Config) *protectedDomains {
+	patterns := make([]string, 0, len(cfg.Reconcile.ProtectedDomains))
+	for _, pattern := range cfg.Reconcile.ProtectedDomains {
+		pattern = strings.Trim(strings.ToLower(strings.TrimSpace(pattern)), ".")
+		// exact names compare against normalized aliases, e.g. in punycode
+		if !isGlob(pattern) {
+			if name, err := dnsname.Normalize(pattern); err == nil {
+				pattern = name
+			}
+		}
+		patterns = append(patterns, pattern)
+	}
+	return &protectedDomains{
+		patterns: patterns,
+		create:   cfg.Reconcile.CreateProtectedDomains,
+	}
+}
+
+func (p *protectedDomains) matches(name string) bool {
+	for _, pattern := range p.patterns {
+		// validated on config load
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// desired returns the exact protected names to create regardless of routers, globs are skipped
+func (p *protectedDomains) desired() []sourcedDomain {
+	if !p.create {
+		return nil
+	}
+	var out []sourcedDomain
+	for _, pattern := range p.patterns {
+		if isGlob(pattern) {
+			continue
+		}
+		out = append(out, sourcedDomain{name: pattern, source: model.Source{Fragment: "reconcile.protected_domains"}})
+	}
+	return out
+}
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
@@ -0,0 +1,77 @@
+package syncer
+
+import (
+	"github.com/0x464e/traefik-opnsense-sync/internal/model"
+	"github.com/0x464e/traefik-opnsense-sync/internal/traefik"
+)
+
+// Result summarises a single sync cycle
+type Result struct {
+	Plan *model.Plan
+
+	// ParseErrors lists the router rules that failed to parse in this cycle
+	ParseErrors []*traefik.ParseError
+	// DeletesSuppressed is set when no deletes were planned because the domains of a failed router are unknown
+	DeletesSuppressed bool
+	// Collisions lists names claimed by more than one router
+	Collisions []Collision
+	// OutsideZones lists names outside every configured zone, under the warn and skip policies
+	OutsideZones []string
+	// UnmatchedExpansions lists expansion hosts of a router that match none of its regexes
+	UnmatchedExpansions []string
+	// InvalidNames lists names that failed normalisation and were not synced
+	InvalidNames []InvalidName
+	// MissingParents lists configured host overrides that do not exist in OPNsense
+	MissingParents []string
+	// Compactions lists groups of aliases replaced by a single wildcard alias
+	Compactions []Compaction
+	// HeldBack counts managed aliases outside the targets, left alone while a target is missing
+	HeldBack int
+	// Migrations lists managed aliases found under a host override that is no longer a target
+	Migrations []Migration
+	// Protected lists managed aliases that are no longer desired, but kept as protected domains
+	Protected []string
+	// Adoptions lists unmanaged aliases in a desired slot, adopted or only reported depending on reconcile.adoption
+	Adoptions []string
+	// Disabled lists managed aliases disabled in OPNsense and left so under the respect policy
+	Disabled []string
+	// Duplicates counts managed aliases deleted for sharing a slot with another one
+	Duplicates int
+	// Conflicts lists desired names that already exist as unmanaged DNS entries elsewhere
+	Conflicts []Conflict
+}
+
+type Conflict struct {
+	Key    string
+	Target string
+	// With describes the conflicting entry
+	With string
+}
+
+func (c Conflict) String() string {
+	return c.Key + " (" + c.Target + ") with " + c.With
+}
+
+type Migration struct {
+	Key  string
+	From string
+	// To is the target the alias is moved under, or empty if it is deleted
+	To string
+}
+
+type Compaction struct {
+	Target string
+	Domain string
+	Names  []string
+}
+
+type InvalidName struct {
+	Name   string
+	Source model.Source
+	Err    error
+}
+
+type Collision struct {
+	Key     string
+	Routers []string
+}
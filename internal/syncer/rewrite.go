@@ -0,0 +1,79 @@
+package syncer
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/config"
+	"github.com/0x464e/traefik-opnsense-sync/internal/slicesx"
+)
+
+// rewriter applies the configured rewrite rules to names before aliases are created.
+// Rules run in order, each on the output of the previous ones.
+type rewriter struct {
+	rules []rewriteRule
+}
+
+type rewriteRule struct {
+	// either re or suffix is set
+	re           *regexp.Regexp
+	suffix       string
+	replacement  string
+	keepOriginal bool
+}
+
+func newRewriter(cfg *config.Config) *rewriter {
+	rules := make([]rewriteRule, 0, len(cfg.Reconcile.Rewrites))
+	for _, rewrite := range cfg.Reconcile.Rewrites {
+		rule := rewriteRule{
+			suffix: strings.ToLower(rewrite.Suffix),
+			// left as is, capture group names are case-sensitive. The rewritten name is lower-cased instead.
+			replacement:  rewrite.Replacement,
+			keepOriginal: rewrite.KeepOriginal,
+		}
+		if rewrite.Regex != "" {
+			// validated on config load
+			rule.re = regexp.MustCompile(rewrite.Regex)
+		}
+		rules = append(rules, rule)
+	}
+	return &rewriter{rules: rules}
+}
+
+// apply returns the names name is rewritten to, name itself is only included if no rule
+// matched it or the matching rules keep the original
+func (r *rewriter) apply(name string) []string {
+	names := []string{name}
+	for _, rule := range r.rules {
+		var next []string
+		for _, n := range names {
+			rewritten, matched := rule.rewrite(n)
+			if !matched {
+				next = append(next, n)
+				continue
+			}
+			if rule.keepOriginal {
+				next = append(next, n)
+			}
+			next = append(next, rewritten)
+		}
+		names = slicesx.Unique(next)
+	}
+	return names
+}
+
+func (r rewriteRule) rewrite(name string) (string, bool) {
+	if r.re != nil {
+		if !r.re.MatchString(name) {
+			return "", false
+		}
+		// replacement may reference capture groups, e.g. $1 or ${name}
+		return strings.ToLower(r.re.ReplaceAllString(name, r.replacement)), true
+	}
+
+	prefix, found := strings.CutSuffix(name, r.suffix)
+	if !found {
+		return "", false
+	}
+	return strings.ToLower(prefix + r.replacement), true
+}
@@ -0,0 +1,34 @@
+package syncer
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRewriteKeepsCaseOfCaptureGroups(t *testing.T) {
+	e := newTestEngine(t, map[string]any{
+		"reconcile": map[string]any{
+			"rewrites": []map[string]any{
+				{"regex": `^(?P<App>[a-z0-9-]+)\.example\.com$`, "replacement": "${App}.Home.Arpa", "keep_original": true},
+				{"suffix": "-ext.home.arpa", "replacement": ".home.arpa"},
+			},
+		},
+	})
+	routers := testSnapshot(map[string]string{
+		"grafana@docker": "Host(`grafana.example.com`)",
+		"wiki@docker":    "Host(`wiki-ext.example.com`)",
+	}).RouterList()
+
+	aliases, err := e.desiredFromTraefik(routers, &Result{})
+	if err != nil {
+		t.Fatalf("desiredFromTraefik: %v", err)
+	}
+	var keys []string
+	for _, alias := range aliases {
+		keys = append(keys, alias.Key())
+	}
+	want := []string{"grafana.example.com", "grafana.home.arpa", "wiki-ext.example.com", "wiki.home.arpa"}
+	if !slices.Equal(keys, want) {
+		t.Fatalf("expected %v, got %v", want, keys)
+	}
+}
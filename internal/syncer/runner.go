@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"log"
+	"net/netip"
+	"strings"
 
 	"github.com/0x464e/traefik-opnsense-sync/internal/config"
 	"github.com/0x464e/traefik-opnsense-sync/internal/model"
@@ -12,71 +14,274 @@ import (
 )
 
 type Runner struct {
-	engine       *Engine
-	traefik      traefik.Client
-	opnsense     opnsense.Client
-	hostOverride string
-	dryRun       bool
+	engine   *Engine
+	traefik  traefik.Client
+	opnsense opnsense.Client
+	backend  string
+	mode     string
+	dryRun   bool
+
+	// collisions already logged, so a long-lived collision is only reported once
+	knownCollisions map[string]string
+	// compactions already logged, keyed by target and domain
+	knownCompactions map[string]string
+	// protected aliases already reported as kept
+	knownProtected string
+	// adoptable aliases already reported
+	knownAdoptions string
+	// disabled aliases already reported
+	knownDisabled string
+	// conflicts already reported
+	knownConflicts string
+	// expansion hosts matching no regex of their router already reported
+	knownUnmatched string
 }
 
 func NewRunner(config *config.Config) *Runner {
 	return &Runner{
-		engine:       newEngine(config),
-		traefik:      traefik.NewClient(config.Traefik.BaseURL, config.Traefik.VerifyTLS, config.Traefik.Username, config.Traefik.Password),
-		opnsense:     opnsense.NewClient(config.OPNsense.BaseURL, config.OPNsense.VerifyTLS, config.OPNsense.APIKey, config.OPNsense.APISecret),
-		hostOverride: config.OPNsense.HostOverride,
-		dryRun:       config.DryRun,
+		engine:   newEngine(config),
+		traefik:  traefik.NewClient(config.Traefik.BaseURL, config.Traefik.VerifyTLS, config.Traefik.Username, config.Traefik.Password),
+		opnsense: newOPNsenseClient(config),
+		backend:  config.OPNsense.Backend,
+		mode:     config.OPNsense.Mode,
+		dryRun:   config.DryRun,
+
+		knownCollisions:  make(map[string]string),
+		knownCompactions: make(map[string]string),
+	}
+}
+
+func newOPNsenseClient(config *config.Config) opnsense.Client {
+	if config.OPNsense.Mode == "override" {
+		addresses := make(map[string]string, len(config.OPNsense.Addresses))
+		for _, address := range config.OPNsense.Addresses {
+			// validated on config load
+			ip := netip.MustParseAddr(strings.TrimSpace(address.IP))
+			addresses[strings.ToLower(strings.TrimSpace(address.HostOverride))] = ip.String()
+		}
+		return opnsense.NewOverrideClient(config.OPNsense.BaseURL, config.OPNsense.VerifyTLS, config.OPNsense.APIKey, config.OPNsense.APISecret, addresses)
 	}
+	if config.OPNsense.Backend == "dnsmasq" {
+		return opnsense.NewDnsmasqClient(config.OPNsense.BaseURL, config.OPNsense.VerifyTLS, config.OPNsense.APIKey, config.OPNsense.APISecret)
+	}
+	return opnsense.NewClient(config.OPNsense.BaseURL, config.OPNsense.VerifyTLS, config.OPNsense.APIKey, config.OPNsense.APISecret)
 }
 
-func (r *Runner) Sync(ctx context.Context) error {
-	hostOverrideUUID, found, err := r.opnsense.FindHostOverrideUUID(ctx, r.hostOverride)
+func (r *Runner) Sync(ctx context.Context) (*Result, error) {
+	hostOverrides, err := r.opnsense.GetHostOverrides(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if !found {
-		return errors.New("host override '" + r.hostOverride + "' not found from OPNsense Unbound\nSee docs for setup instructions")
+
+	// resolve every target host override. A missing host override is reported by the
+	// engine, but does not stop the others from being synced
+	parents := make(map[string]string)
+	targetsByUUID := make(map[string]string)
+	for _, target := range r.engine.targetMapper.targets() {
+		hostOverrideUUID, found := findHostOverrideUUID(hostOverrides, target)
+		if !found {
+			continue
+		}
+		parents[target] = hostOverrideUUID
+		targetsByUUID[hostOverrideUUID] = target
 	}
 
-	currentHostAliases, err := r.opnsense.GetHostAliases(ctx, hostOverrideUUID)
+	// aliases are fetched from every host override, so managed aliases left under a former
+	// target are found and migrated
+	aliases, err := r.opnsense.GetHostAliases(ctx)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	parentTargets := make(map[string]string, len(hostOverrides))
+	for _, hostOverride := range hostOverrides {
+		// a managed alias is never the parent of other aliases
+		if r.engine.describer.owns(hostOverride.Description) {
+			continue
+		}
+		target, ok := targetsByUUID[hostOverride.UUID]
+		if !ok {
+			target = strings.ToLower(hostOverride.Key())
+		}
+		parentTargets[hostOverride.UUID] = target
+	}
+	var currentHostAliases []model.HostAlias
+	for _, alias := range aliases {
+		target, ok := parentTargets[alias.Parent]
+		if !ok {
+			continue
+		}
+		alias.Target = target
+		currentHostAliases = append(currentHostAliases, alias)
 	}
 
-	routers, err := r.traefik.GetRouters(ctx)
+	snapshot, err := r.traefik.GetSnapshot(ctx)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// in override mode the host overrides are stand-ins for addresses, the real records are among the aliases
+	unmanagedOverrides := hostOverrides
+	if r.mode == "override" {
+		unmanagedOverrides = nil
 	}
 
-	plan, err := r.engine.computePlan(routers, currentHostAliases)
+	result, err := r.engine.computePlan(snapshot, currentHostAliases, unmanagedOverrides, parents)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	r.logResult(result)
 
-	return r.executePlan(ctx, plan, hostOverrideUUID)
+	return result, r.executePlan(ctx, result.Plan)
 }
 
-func (r *Runner) executePlan(ctx context.Context, plan *model.Plan, hostOverrideUUID string) error {
+func findHostOverrideUUID(hostOverrides []model.HostOverride, fqdn string) (string, bool) {
+	for _, hostOverride := range hostOverrides {
+		if strings.EqualFold(hostOverride.Key(), fqdn) {
+			return hostOverride.UUID, true
+		}
+	}
+	return "", false
+}
+
+func (r *Runner) logResult(result *Result) {
+	for _, missing := range result.MissingParents {
+		log.Printf("[Warning] host override '%s' not found from OPNsense %s, skipping its aliases. See docs for setup instructions", missing, r.backend)
+	}
+	if result.HeldBack > 0 {
+		log.Printf("[Warning] leaving %d managed alias(es) outside the target host overrides untouched until every target is found", result.HeldBack)
+	}
+	for _, parseErr := range result.ParseErrors {
+		log.Printf("[Warning] skipped router: %v", parseErr)
+	}
+	if result.DeletesSuppressed {
+		log.Println("[Warning] deletes suppressed this cycle, the domains of a router that failed to parse are unknown")
+	}
+
+	unmatched := strings.Join(result.UnmatchedExpansions, ", ")
+	if unmatched != "" && unmatched != r.knownUnmatched {
+		log.Printf("[Warning] %d expansion host(s) match no regex of their router and are not synced: %s", len(result.UnmatchedExpansions), unmatched)
+	}
+	r.knownUnmatched = unmatched
+
+	for _, invalid := range result.InvalidNames {
+		log.Printf("[Warning] skipped name from %s: %v", invalid.Source, invalid.Err)
+	}
+	if len(result.OutsideZones) > 0 {
+		action := "using default split for"
+		if r.engine.zoneSplitter.policy == "skip" {
+			action = "skipped"
+		}
+		log.Printf("[Warning] %s %d name(s) outside configured zones: %s", action, len(result.OutsideZones), strings.Join(result.OutsideZones, ", "))
+	}
+
+	collisions := make(map[string]string, len(result.Collisions))
+	for _, collision := range result.Collisions {
+		routers := strings.Join(collision.Routers, ", ")
+		collisions[collision.Key] = routers
+		if r.knownCollisions[collision.Key] != routers {
+			log.Printf("[Warning] %s is claimed by multiple routers: %s", collision.Key, routers)
+		}
+	}
+	r.knownCollisions = collisions
+
+	compactions := make(map[string]string, len(result.Compactions))
+	for _, compaction := range result.Compactions {
+		key := compaction.Target + "|" + compaction.Domain
+		names := strings.Join(compaction.Names, ", ")
+		compactions[key] = names
+		if r.knownCompactions[key] != names {
+			log.Printf("compacted %s: %s", compaction, names)
+		}
+	}
+	r.knownCompactions = compactions
+
+	protected := strings.Join(result.Protected, ", ")
+	if protected != "" && protected != r.knownProtected {
+		log.Printf("[Warning] kept %d protected alias(es) no router exposes anymore: %s", len(result.Protected), protected)
+	}
+	r.knownProtected = protected
+
+	adoptions := strings.Join(result.Adoptions, ", ")
+	if adoptions != "" && r.engine.adoption == "on" {
+		log.Printf("adopting %d unmanaged alias(es): %s", len(result.Adoptions), adoptions)
+	} else if adoptions != "" && adoptions != r.knownAdoptions {
+		log.Printf("[Warning] %d unmanaged alias(es) serve desired names and would be adopted with reconcile.adoption on: %s", len(result.Adoptions), adoptions)
+	}
+	r.knownAdoptions = adoptions
+
+	conflicts := make([]string, 0, len(result.Conflicts))
+	for _, conflict := range result.Conflicts {
+		conflicts = append(conflicts, conflict.String())
+	}
+	joined := strings.Join(conflicts, ", ")
+	if joined != "" && joined != r.knownConflicts {
+		action := "skipped"
+		if r.engine.conflictPolicy == "create" {
+			action = "created anyway"
+		}
+		log.Printf("[Warning] %s %d name(s) conflicting with unmanaged DNS entries: %s", action, len(result.Conflicts), joined)
+	}
+	r.knownConflicts = joined
+
+	if result.Duplicates > 0 {
+		log.Printf("[Warning] cleaning up %d duplicate managed alias(es), keeping one of each", result.Duplicates)
+	}
+
+	disabled := strings.Join(result.Disabled, ", ")
+	if disabled != "" && disabled != r.knownDisabled {
+		log.Printf("[Warning] leaving %d managed alias(es) disabled in OPNsense as they are: %s", len(result.Disabled), disabled)
+	}
+	r.knownDisabled = disabled
+
+	if len(result.Migrations) > 0 {
+		var moves, deletes []string
+		for _, migration := range result.Migrations {
+			if migration.To == "" {
+				deletes = append(deletes, migration.Key+" ("+migration.From+")")
+			} else {
+				moves = append(moves, migration.Key+" ("+migration.From+" → "+migration.To+")")
+			}
+		}
+		log.Printf("[Warning] migrating %d managed alias(es) from host overrides that are no longer targets", len(result.Migrations))
+		if len(moves) > 0 {
+			log.Printf("moving: %s", strings.Join(moves, ", "))
+		}
+		if len(deletes) > 0 {
+			log.Printf("deleting, no longer desired under any target: %s", strings.Join(deletes, ", "))
+		}
+	}
+}
+
+func (r *Runner) executePlan(ctx context.Context, plan *model.Plan) error {
 	if r.dryRun {
 		for _, op := range plan.Operations {
-			log.Printf("[Dry Run] %s alias: %s", op.Kind.String(), op.Alias.Key())
+			log.Printf("[Dry Run] %s alias: %s → %s%s", op.Kind.String(), op.Alias.Key(), op.Alias.Target, op.Details())
 		}
 		return nil
 	}
 
-	var createCount, deleteCount int
+	var createCount, updateCount, deleteCount int
 	var errs []error
 
 	for _, op := range plan.Operations {
 		switch op.Kind {
 		case model.OpCreate:
-			_, err := r.opnsense.AddHostAlias(ctx, op.Alias, hostOverrideUUID)
+			_, err := r.opnsense.AddHostAlias(ctx, op.Alias, op.Alias.Parent)
 			if err != nil {
 				errs = append(errs, err)
 				log.Printf("Error creating alias %s: %v", op.Alias.Key(), err)
 			} else {
 				createCount++
-				log.Printf("Created alias: %s", op.Alias.Key())
+				log.Printf("Created alias: %s → %s%s", op.Alias.Key(), op.Alias.Target, op.Details())
+			}
+		case model.OpUpdate:
+			err := r.opnsense.SetHostAlias(ctx, op.Alias)
+			if err != nil {
+				errs = append(errs, err)
+				log.Printf("Error updating alias %s: %v", op.Alias.Key(), err)
+			} else {
+				updateCount++
+				log.Printf("Updated alias: %s → %s%s", op.Alias.Key(), op.Alias.Target, op.Details())
 			}
 		case model.OpDelete:
 			err := r.opnsense.DeleteHostAlias(ctx, op.Alias)
@@ -85,18 +290,18 @@ func (r *Runner) executePlan(ctx context.Context, plan *model.Plan, hostOverride
 				log.Printf("Error deleting alias %s: %v", op.Alias.Key(), err)
 			} else {
 				deleteCount++
-				log.Printf("Deleted alias: %s", op.Alias.Key())
+				log.Printf("Deleted alias: %s → %s%s", op.Alias.Key(), op.Alias.Target, op.Details())
 			}
 		}
 	}
 
-	if createCount > 0 || deleteCount > 0 {
-		err := r.opnsense.ReconfigureUnbound(ctx)
+	if createCount > 0 || updateCount > 0 || deleteCount > 0 {
+		err := r.opnsense.Reconfigure(ctx)
 		if err != nil {
 			errs = append(errs, err)
 			log.Printf("Error applying changes: %v", err)
 		} else {
-			log.Printf("Applied changes to OPNsense Unbound: %d created, %d deleted", createCount, deleteCount)
+			log.Printf("Applied changes to OPNsense %s: %d created, %d updated, %d deleted", r.backend, createCount, updateCount, deleteCount)
 		}
 	}
 
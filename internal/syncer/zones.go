@@ -0,0 +1,79 @@
+package syncer
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/config"
+)
+
+// zoneSplitter decides where a FQDN is split into hostname and domain, based on the
+// longest configured zone the name falls under
+type zoneSplitter struct {
+	// sorted longest first
+	zones  []string
+	policy string
+}
+
+func newZoneSplitter(cfg *config.Config) *zoneSplitter {
+	seen := make(map[string]struct{})
+	var zones []string
+	add := func(zone string) {
+		zone = strings.Trim(strings.ToLower(strings.TrimSpace(zone)), ".")
+		if zone == "" {
+			return
+		}
+		if _, ok := seen[zone]; ok {
+			return
+		}
+		seen[zone] = struct{}{}
+		zones = append(zones, zone)
+	}
+
+	for _, zone := range cfg.Reconcile.Zones {
+		add(zone)
+	}
+	// the domains of the target host overrides themselves are always zones
+	for _, target := range newTargetMapper(cfg).targets() {
+		if _, domain, found := strings.Cut(target, "."); found {
+			add(domain)
+		}
+	}
+
+	sort.SliceStable(zones, func(i, j int) bool {
+		return len(zones[i]) > len(zones[j])
+	})
+
+	return &zoneSplitter{
+		zones:  zones,
+		policy: cfg.Reconcile.OutsideZonePolicy,
+	}
+}
+
+// split returns the hostname and domain for name. inZone is false if name is outside every zone,
+// in which case ok tells whether the outside zone policy still allows the name. A zone itself has
+// no hostname to alias, so it is in its zone but not ok.
+func (z *zoneSplitter) split(name string) (hostname, domain string, inZone, ok bool) {
+	// a wildcard only works as the hostname of its parent domain
+	if parent, found := strings.CutPrefix(name, "*."); found {
+		return "*", parent, true, true
+	}
+
+	for _, zone := range z.zones {
+		if name == zone {
+			return "", "", true, false
+		}
+		if prefix, found := strings.CutSuffix(name, "."+zone); found && prefix != "" {
+			return prefix, zone, true, true
+		}
+	}
+
+	if z.policy == "skip" {
+		return "", "", false, false
+	}
+	hostname, domain, found := strings.Cut(name, ".")
+	if !found || hostname == "" || domain == "" {
+		return "", "", false, false
+	}
+	return hostname, domain, false, true
+}
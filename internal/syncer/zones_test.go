@@ -0,0 +1,47 @@
+package syncer
+
+import "testing"
+
+func TestZoneSplitterSplit(t *testing.T) {
+	e := newTestEngine(t, map[string]any{
+		"reconcile": map[string]any{"zones": []string{"example.com", "home.arpa"}},
+	})
+	tests := []struct {
+		name             string
+		hostname, domain string
+		inZone, ok       bool
+	}{
+		{"app.example.com", "app", "example.com", true, true},
+		{"api.v2.app.example.com", "api.v2.app", "example.com", true, true},
+		{"*.dev.example.com", "*", "dev.example.com", true, true},
+		{"nas.home.arpa", "nas", "home.arpa", true, true},
+		// a zone apex has no hostname to alias
+		{"example.com", "", "", true, false},
+		{"home.arpa", "", "", true, false},
+		{"app.other.org", "app", "other.org", false, true},
+		{"localhost", "", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hostname, domain, inZone, ok := e.zoneSplitter.split(tt.name)
+			if hostname != tt.hostname || domain != tt.domain || inZone != tt.inZone || ok != tt.ok {
+				t.Fatalf("expected %q %q %v %v, got %q %q %v %v", tt.hostname, tt.domain, tt.inZone, tt.ok, hostname, domain, inZone, ok)
+			}
+		})
+	}
+}
+
+func TestDesiredSkipsZoneApex(t *testing.T) {
+	e := newTestEngine(t, nil)
+	routers := testSnapshot(map[string]string{
+		"app@docker": "Host(`example.com`) || Host(`app.example.com`)",
+	}).RouterList()
+
+	aliases, err := e.desiredFromTraefik(routers, &Result{})
+	if err != nil {
+		t.Fatalf("desiredFromTraefik: %v", err)
+	}
+	if len(aliases) != 1 || aliases[0].Key() != "app.example.com" {
+		t.Fatalf("expected only app.example.com, got %+v", aliases)
+	}
+}
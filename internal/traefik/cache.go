@@ -0,0 +1,66 @@
+package traefik
+
+import (
+	"errors"
+	"sync"
+)
+
+// RuleCache memoises ParseDomains results by rule string. Entries that were not looked up
+// since the previous Sweep are evicted by it, so rules of removed routers do not pile up.
+type RuleCache struct {
+	mu      sync.Mutex
+	entries map[string]*ruleCacheEntry
+}
+
+type ruleCacheEntry struct {
+	domains []DomainMatch
+	err     error
+	used    bool
+}
+
+func NewRuleCache() *RuleCache {
+	return &RuleCache{
+		entries: make(map[string]*ruleCacheEntry),
+	}
+}
+
+// ParseRouterDomains is ParseDomains for the rule of a router, cached by rule. Parse errors carry
+// the router name. The returned slice is shared between callers and must not be modified.
+func (c *RuleCache) ParseRouterDomains(router Router) ([]DomainMatch, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[router.Rule]
+	if !ok {
+		domains, err := ParseDomains(router.Rule)
+		entry = &ruleCacheEntry{domains: domains, err: err}
+		c.entries[router.Rule] = entry
+	}
+	entry.used = true
+	c.mu.Unlock()
+
+	if entry.err != nil {
+		// cached errors are shared between routers with the same rule, so copy before naming the router
+		var parseErr *ParseError
+		if errors.As(entry.err, &parseErr) {
+			return nil, &ParseError{Router: router.Name, Rule: parseErr.Rule, Err: parseErr.Err}
+		}
+		return nil, entry.err
+	}
+	return entry.domains, nil
+}
+
+// Sweep evicts entries not used since the previous sweep and returns how many were evicted
+func (c *RuleCache) Sweep() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	evicted := 0
+	for rule, entry := range c.entries {
+		if !entry.used {
+			delete(c.entries, rule)
+			evicted++
+			continue
+		}
+		entry.used = false
+	}
+	return evicted
+}
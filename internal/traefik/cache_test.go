@@ -0,0 +1,104 @@
+package traefik
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRuleCacheSweepEvictsUnused(t *testing.T) {
+	c := NewRuleCache()
+	a := Router{Name: "a@docker", Rule: "Host(`a.example.com`)"}
+	b := Router{Name: "b@docker", Rule: "Host(`b.example.com`)"}
+
+	_, _ = c.ParseRouterDomains(a)
+	_, _ = c.ParseRouterDomains(b)
+	if evicted := c.Sweep(); evicted != 0 {
+		t.Fatalf("expected nothing evicted right after use, got %d", evicted)
+	}
+
+	_, _ = c.ParseRouterDomains(a)
+	if evicted := c.Sweep(); evicted != 1 {
+		t.Fatalf("expected the unused rule evicted, got %d", evicted)
+	}
+	if _, ok := c.entries[b.Rule]; ok {
+		t.Fatal("unused rule is still cached")
+	}
+	if _, ok := c.entries[a.Rule]; !ok {
+		t.Fatal("used rule was evicted")
+	}
+
+	if evicted := c.Sweep(); evicted != 1 || len(c.entries) != 0 {
+		t.Fatalf("expected the last rule evicted after a cycle without use, got %d evicted and %d left", evicted, len(c.entries))
+	}
+}
+
+func TestRuleCacheMatchesParseDomains(t *testing.T) {
+	c := NewRuleCache()
+	router := Router{Name: "app@docker", Rule: "Host(`app.example.com`) || HostRegexp(`^(a|b)\\.example\\.com$`)"}
+
+	want, err := ParseDomains(router.Rule)
+	if err != nil {
+		t.Fatalf("ParseDomains: %v", err)
+	}
+	for range 2 {
+		got, err := c.ParseRouterDomains(router)
+		if err != nil {
+			t.Fatalf("ParseRouterDomains: %v", err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestRuleCacheNamesRouterOfCachedError(t *testing.T) {
+	c := NewRuleCache()
+	rule := "Host(`app.example.com`"
+
+	for _, name := range []string{"a@docker", "b@docker"} {
+		_, err := c.ParseRouterDomains(Router{Name: name, Rule: rule})
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("expected a ParseError, got %v", err)
+		}
+		if parseErr.Router != name {
+			t.Fatalf("expected the error to name %s, got %s", name, parseErr.Router)
+		}
+	}
+}
+
+func benchmarkRouters(n int) []Router {
+	routers := make([]Router, 0, n)
+	for i := range n {
+		routers = append(routers, Router{
+			Name: fmt.Sprintf("app%d@docker", i),
+			Rule: fmt.Sprintf("(Host(`app%d.example.com`) || HostRegexp(`^(www|api)\\.app%d\\.example\\.com$`)) && PathPrefix(`/`)", i, i),
+		})
+	}
+	return routers
+}
+
+func BenchmarkParseDomains(b *testing.B) {
+	routers := benchmarkRouters(3000)
+	for b.Loop() {
+		for _, router := range routers {
+			_, _ = ParseDomains(router.Rule)
+		}
+	}
+}
+
+func BenchmarkRuleCacheParseRouterDomains(b *testing.B) {
+	routers := benchmarkRouters(3000)
+	c := NewRuleCache()
+	for _, router := range routers {
+		_, _ = c.ParseRouterDomains(router)
+	}
+	for b.Loop() {
+		// one sync cycle: every router looked up, then the sweep
+		for _, router := range routers {
+			_, _ = c.ParseRouterDomains(router)
+		}
+		c.Sweep()
+	}
+}
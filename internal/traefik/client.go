@@ -8,10 +8,10 @@ import (
 	"github.com/0x464e/traefik-opnsense-sync/internal/httpx"
 )
 
-const routersApi = "/api/http/routers"
+const rawDataApi = "/api/rawdata"
 
 type Client interface {
-	GetRouters(ctx context.Context) ([]Router, error)
+	GetSnapshot(ctx context.Context) (*Snapshot, error)
 }
 
 type client struct {
@@ -32,13 +32,14 @@ func NewClient(baseURL string, verifyTls bool, username, password string) Client
 	}
 }
 
-func (c *client) GetRouters(ctx context.Context) ([]Router, error) {
-	url := c.baseURL + routersApi
+// GetSnapshot fetches the whole dynamic configuration in a single call, so every lookup
+// during a sync cycle works on one consistent view of Traefik
+func (c *client) GetSnapshot(ctx context.Context) (*Snapshot, error) {
+	url := c.baseURL + rawDataApi
 
-	var routers []Router
-
-	if err := httpx.JsonRequest(ctx, c.http, http.MethodGet, url, nil, &routers, c.username, c.password); err != nil {
+	var raw rawData
+	if err := httpx.JsonRequest(ctx, c.http, http.MethodGet, url, nil, &raw, c.username, c.password); err != nil {
 		return nil, err
 	}
-	return routers, nil
+	return newSnapshot(raw), nil
 }
@@ -3,11 +3,16 @@ package traefik
 // Base treeBuilder and parser -related code copied and adapted from the Traefik source code
 
 import (
+	"errors"
+	"regexp/syntax"
 	"strings"
+	"sync"
 
 	"github.com/vulcand/predicate"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
+
+	"github.com/0x464e/traefik-opnsense-sync/internal/slicesx"
 )
 
 const (
@@ -31,6 +36,11 @@ var httpFuncs = []string{
 	"HeadersRegexp",
 }
 
+// the parser only depends on the static matcher list, so it is built once and reused
+var httpParser = sync.OnceValues(func() (predicate.Parser, error) {
+	return newParser(httpFuncs)
+})
+
 type treeBuilder func() *tree
 
 type tree struct {
@@ -127,6 +137,25 @@ func (tree *tree) parseMatchers(matchers []string) []string {
 	}
 }
 
+func (tree *tree) format(b *strings.Builder, depth int) {
+	b.WriteString(strings.Repeat("  ", depth))
+	switch tree.Matcher {
+	case and, or:
+		b.WriteString(strings.ToUpper(tree.Matcher) + "\n")
+		tree.RuleLeft.format(b, depth+1)
+		tree.RuleRight.format(b, depth+1)
+	default:
+		if tree.Not {
+			b.WriteString("!")
+		}
+		values := make([]string, 0, len(tree.Value))
+		for _, v := range tree.Value {
+			values = append(values, "`"+v+"`")
+		}
+		b.WriteString(tree.Matcher + "(" + strings.Join(values, ", ") + ")\n")
+	}
+}
+
 func lower(slice []string) []string {
 	var lowerStrings []string
 	for _, value := range slice {
@@ -154,7 +183,7 @@ func (tree *tree) collectHostMatches(matchers []string) (out []DomainMatch, neg
 					neg = append(neg, vals...)
 				} else {
 					for _, v := range vals {
-						out = append(out, DomainMatch{Value: v, Kind: kind})
+						out = append(out, DomainMatch{Value: v, Kind: kind, Fragment: m + "(`" + v + "`)"})
 					}
 				}
 				break
@@ -164,53 +193,149 @@ func (tree *tree) collectHostMatches(matchers []string) (out []DomainMatch, neg
 	}
 }
 
-// returns a deduped order-preserving slice.
-func unique(in []string) []string {
-	seen := make(map[string]struct{}, len(in))
-	out := make([]string, 0, len(in))
-	for _, v := range in {
-		if _, ok := seen[v]; !ok {
-			seen[v] = struct{}{}
-			out = append(out, v)
-		}
+func ParseDomains(rule string) ([]DomainMatch, error) {
+	ruleTree, err := parseTree(rule)
+	if err != nil {
+		return nil, err
 	}
-	return out
+	domains, _ := ruleTree.domains()
+	return domains, nil
 }
 
-func ParseDomains(rule string) ([]DomainMatch, error) {
-	parser, _ := newParser(httpFuncs)
-	parse, _ := parser.Parse(rule)
-	buildTree, _ := parse.(treeBuilder)
+// RuleExplanation describes how a rule is parsed and which host matchers it contains
+type RuleExplanation struct {
+	Tree string
+	// Domains are the positive host matchers, after removing negated values
+	Domains []DomainMatch
+	Negated []string
+}
+
+func ExplainRule(rule string) (*RuleExplanation, error) {
+	ruleTree, err := parseTree(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	ruleTree.format(&b, 0)
+
+	domains, negated := ruleTree.domains()
+	return &RuleExplanation{
+		Tree:    b.String(),
+		Domains: domains,
+		Negated: negated,
+	}, nil
+}
+
+func parseTree(rule string) (*tree, error) {
+	parser, err := httpParser()
+	if err != nil {
+		return nil, err
+	}
+	parse, err := parser.Parse(rule)
+	if err != nil {
+		return nil, &ParseError{Rule: rule, Err: err}
+	}
+	buildTree, ok := parse.(treeBuilder)
+	if !ok {
+		return nil, &ParseError{Rule: rule, Err: errors.New("rule is not a matcher expression")}
+	}
+	return buildTree(), nil
+}
 
-	matches, neg := buildTree().collectHostMatches([]string{"Host", "HostRegexp"})
+// domains returns the positive host matches of the tree and the negated host values
+func (tree *tree) domains() ([]DomainMatch, []string) {
+	matches, neg := tree.collectHostMatches([]string{"Host", "HostRegexp"})
 
 	// build a set of negatives for quick filtering
 	negSet := make(map[string]struct{}, len(neg))
-	for _, n := range unique(neg) {
+	for _, n := range slicesx.Unique(neg) {
 		negSet[n] = struct{}{}
 	}
 
-	// de-dupe positives by value while preserving first-seen Kind
-	seen := make(map[string]DomainKind, len(matches))
+	// de-dupe positives by value while preserving first-seen order, a regex wins over a literal
+	seen := make(map[string]DomainMatch, len(matches))
 	order := make([]string, 0, len(matches))
 
 	for _, m := range matches {
 		if _, blocked := negSet[m.Value]; blocked {
 			continue
 		}
-		if prevKind, ok := seen[m.Value]; ok {
-			if prevKind == DomainLiteral && m.Kind == DomainRegex {
-				seen[m.Value] = DomainRegex
+		if prev, ok := seen[m.Value]; ok {
+			if prev.Kind == DomainLiteral && m.Kind == DomainRegex {
+				seen[m.Value] = m
 			}
 			continue
 		}
-		seen[m.Value] = m.Kind
+		seen[m.Value] = m
 		order = append(order, m.Value)
 	}
 
 	out := make([]DomainMatch, 0, len(order))
 	for _, v := range order {
-		out = append(out, DomainMatch{Value: v, Kind: seen[v]})
+		match := seen[v]
+		if match.Kind == DomainRegex {
+			match.Regex = v
+			if parent, ok := wildcardDomain(v); ok {
+				match.Kind = DomainWildcard
+				match.Value = "*." + parent
+			}
+		}
+		out = append(out, match)
+	}
+	return out, slicesx.Unique(neg)
+}
+
+// wildcardDomain recognises catch-all subdomain patterns such as ^.+\.dev\.example\.com$
+// or ^[a-z0-9-]+\.dev\.example\.com$ and returns the parent domain, e.g. dev.example.com
+func wildcardDomain(pattern string) (string, bool) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	re = re.Simplify()
+	if re.Op != syntax.OpConcat {
+		return "", false
+	}
+
+	subs := re.Sub
+	for len(subs) > 0 && (subs[0].Op == syntax.OpBeginText || subs[0].Op == syntax.OpBeginLine) {
+		subs = subs[1:]
+	}
+	for len(subs) > 0 && (subs[len(subs)-1].Op == syntax.OpEndText || subs[len(subs)-1].Op == syntax.OpEndLine) {
+		subs = subs[:len(subs)-1]
+	}
+	if len(subs) < 2 {
+		return "", false
+	}
+
+	// leading part: one or more of any character, optionally captured
+	head := subs[0]
+	if head.Op == syntax.OpCapture {
+		head = head.Sub[0]
+	}
+	if head.Op != syntax.OpPlus {
+		return "", false
+	}
+	switch head.Sub[0].Op {
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL, syntax.OpCharClass:
+	default:
+		return "", false
+	}
+
+	// trailing part: a plain literal domain
+	var suffix strings.Builder
+	for _, sub := range subs[1:] {
+		if sub.Op != syntax.OpLiteral {
+			return "", false
+		}
+		suffix.WriteString(string(sub.Rune))
+	}
+
+	// require at least two labels in the parent, a wildcard for a whole TLD is never intended
+	parent, found := strings.CutPrefix(suffix.String(), ".")
+	if !found || !strings.Contains(parent, ".") || strings.HasPrefix(parent, ".") || strings.HasSuffix(parent, ".") {
+		return "", false
 	}
-	return out, nil
+	return strings.ToLower(parent), true
 }
@@ -0,0 +1,64 @@
+package traefik
+
+import (
+	"sort"
+	"strings"
+)
+
+// Snapshot is a typed view of the Traefik dynamic configuration at one point in time.
+// All maps are keyed by the fully qualified name, e.g. "myapp@docker".
+type Snapshot struct {
+	Routers     map[string]Router
+	Services    map[string]Service
+	Middlewares map[string]Middleware
+}
+
+func newSnapshot(raw rawData) *Snapshot {
+	snapshot := &Snapshot{
+		Routers:     make(map[string]Router, len(raw.Routers)),
+		Services:    make(map[string]Service, len(raw.Services)),
+		Middlewares: make(map[string]Middleware, len(raw.Middlewares)),
+	}
+
+	// rawdata does not include name/provider in the objects themselves, only in the map keys
+	for key, router := range raw.Routers {
+		router.Name = key
+		router.Provider = providerOf(key)
+		snapshot.Routers[key] = router
+	}
+	for key, service := range raw.Services {
+		service.Name = key
+		snapshot.Services[key] = service
+	}
+	for key, middleware := range raw.Middlewares {
+		middleware.Name = key
+		snapshot.Middlewares[key] = middleware
+	}
+
+	return snapshot
+}
+
+// RouterList returns the routers of the snapshot sorted by name
+func (s *Snapshot) RouterList() []Router {
+	routers := make([]Router, 0, len(s.Routers))
+	for _, router := range s.Routers {
+		routers = append(routers, router)
+	}
+	sort.Slice(routers, func(i, j int) bool {
+		return routers[i].Name < routers[j].Name
+	})
+	return routers
+}
+
+func (s *Snapshot) Router(name string) (Router, bool) {
+	router, ok := s.Routers[name]
+	return router, ok
+}
+
+func providerOf(name string) string {
+	_, provider, found := strings.Cut(name, "@")
+	if !found {
+		return ""
+	}
+	return provider
+}
@@ -1,20 +1,68 @@
 package traefik
 
+import "fmt"
+
 type Router struct {
 	EntryPoints []string `json:"entryPoints"`
+	Middlewares []string `json:"middlewares,omitempty"`
+	Service     string   `json:"service"`
 	Rule        string   `json:"rule"`
+	Priority    int      `json:"priority,omitempty"`
+	Status      string   `json:"status,omitempty"`
 	Name        string   `json:"name"`
 	Provider    string   `json:"provider"`
 }
 
+type Service struct {
+	Status string   `json:"status,omitempty"`
+	UsedBy []string `json:"usedBy,omitempty"`
+	Name   string   `json:"name"`
+}
+
+type Middleware struct {
+	Status string   `json:"status,omitempty"`
+	UsedBy []string `json:"usedBy,omitempty"`
+	Name   string   `json:"name"`
+}
+
+// rawData is the subset of the /api/rawdata response we care about; only the HTTP section is used
+type rawData struct {
+	Routers     map[string]Router     `json:"routers"`
+	Services    map[string]Service    `json:"services"`
+	Middlewares map[string]Middleware `json:"middlewares"`
+}
+
+// ParseError is returned when a router rule cannot be parsed
+type ParseError struct {
+	Router string
+	Rule   string
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	if e.Router == "" {
+		return fmt.Sprintf("parse rule %q: %v", e.Rule, e.Err)
+	}
+	return fmt.Sprintf("router %s: parse rule %q: %v", e.Router, e.Rule, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
 type DomainKind int
 
 const (
 	DomainLiteral DomainKind = iota
 	DomainRegex
+	DomainWildcard
 )
 
 type DomainMatch struct {
 	Value string
 	Kind  DomainKind
+	// Fragment is the matcher the value came from, e.g. Host(`app.example.com`)
+	Fragment string
+	// Regex is the HostRegexp pattern the match came from, set for DomainRegex and DomainWildcard
+	Regex string
 }